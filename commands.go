@@ -1,16 +1,48 @@
 package main
 
 import (
+	"DNSSEC-Validator/resolver"
 	"github.com/urfave/cli/v2"
 	"runtime"
+	"time"
 )
 
+// limitFlags set the resolver.Limits of the validations, see
+// limitsFromFlags.
+var limitFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:  "max-rrset-verifications",
+		Value: resolver.DefaultLimits.MaxVerificationsPerRRset,
+		Usage: "Maximum number of signature verifications attempted for a single RRset",
+	},
+	&cli.IntFlag{
+		Name:  "max-verifications",
+		Value: resolver.DefaultLimits.MaxVerifications,
+		Usage: "Maximum number of signature verifications attempted for a single validation",
+	},
+	&cli.IntFlag{
+		Name:  "max-keytag-candidates",
+		Value: resolver.DefaultLimits.MaxKeyTagCandidates,
+		Usage: "Maximum number of DNSKEYs sharing a key tag that are tried for a signature or DS",
+	},
+	&cli.UintFlag{
+		Name:  "max-nsec3-iterations",
+		Value: uint(resolver.DefaultLimits.MaxNSEC3Iterations),
+		Usage: "Maximum NSEC3 iteration count accepted in a response (RFC 9276), answers above it are insecure",
+	},
+	&cli.IntFlag{
+		Name:  "max-chain-depth",
+		Value: resolver.DefaultLimits.MaxChainDepth,
+		Usage: "Maximum number of zones in the delegation chain",
+	},
+}
+
 var Commands = []*cli.Command{
 	{
 		Name:   "measure",
 		Usage:  "Run a batch test and measurement job given a list of hostnames",
 		Action: measure,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "inputlist",
 				Aliases: []string{"i"},
@@ -21,7 +53,27 @@ var Commands = []*cli.Command{
 				Name:    "outdir",
 				Aliases: []string{"o"},
 				Value:   "results",
-				Usage:   "Directory to save the output file along with the timestamp of the scan in <OutDir>/results-<Timestamp>.csv",
+				Usage:   "Directory in which the run directory <OutDir>/run-<Timestamp> holding results.csv and its checkpoint is created",
+			},
+			&cli.StringFlag{
+				Name:  "domain-column",
+				Usage: "Read the input as CSV with the names in this column, given as its 1-based index or its name in the header row; the other columns are passed through to the results",
+			},
+			&cli.BoolFlag{
+				Name:  "header",
+				Usage: "Skip the header row of a CSV input whose --domain-column is given by index, and name the columns passed through after it",
+			},
+			&cli.BoolFlag{
+				Name:  "ordered",
+				Usage: "Write the results in input order, with the line number of each input entry in a Line column",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-duplicates",
+				Usage: "Measure names listed more than once every time instead of rejecting the duplicates",
+			},
+			&cli.StringFlag{
+				Name:  "resume",
+				Usage: "Resume the interrupted run in the given run directory, skipping the names already measured and appending to its results.csv",
 			},
 			&cli.IntFlag{
 				Name:    "parallelism",
@@ -29,19 +81,178 @@ var Commands = []*cli.Command{
 				Value:   runtime.NumCPU() * 2,
 				Usage:   "Number of workers to dispatch to complete measurement",
 			},
-		},
+			&cli.IntFlag{
+				Name:  "queue-size",
+				Value: 1000,
+				Usage: "Number of input names and results buffered between the reader, the workers and the writer",
+			},
+			&cli.StringSliceFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Value:   cli.NewStringSlice("A"),
+				Usage:   "Record type to validate, repeat to validate several types independently",
+			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Value: ProfileDNSSEC,
+				Usage: "Measurement profile, dnssec validates the --type records, smtp-dane checks the SMTP DANE readiness (RFC 7672) of mail domains",
+			},
+			&cli.BoolFlag{
+				Name:  "checking-disabled",
+				Value: true,
+				Usage: "Set the CD bit so that upstream resolvers return bogus data instead of SERVFAIL",
+			},
+			&cli.BoolFlag{
+				Name:  "upstream-verdict",
+				Usage: "Issue a second query with the CD bit cleared to record whether the upstream judged the name bogus",
+			},
+			&cli.BoolFlag{
+				Name:  "compare-ad",
+				Usage: "Record the AD bit and RCODE of every upstream and flag disagreements with the local validation",
+			},
+			&cli.BoolFlag{
+				Name:  "cds",
+				Usage: "Check the CDS and CDNSKEY records of the signing zone against its DNSKEY and DS RRsets (RFC 7344, RFC 8078)",
+			},
+			&cli.BoolFlag{
+				Name:  "bootstrap",
+				Usage: "For signed zones without DS at their parent, check whether they can be bootstrapped securely (RFC 9615)",
+			},
+			&cli.BoolFlag{
+				Name:  "diagnose",
+				Usage: "Classify the misconfiguration behind failed validations, e.g. orphan DS, stale DS or algorithm mismatch",
+			},
+			&cli.BoolFlag{
+				Name:  "ns-consistency",
+				Usage: "Query every name server of each zone in the chain directly and compare their SOA serials and DNSKEY RRsets",
+			},
+		}, limitFlags...),
 	},
 	{
 		Name:   "query",
 		Usage:  "Run an individual test given a hostname",
 		Action: singleMeasure,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "fqdn",
 				Aliases: []string{"d"},
 				Value:   "sudheesh.info.",
 				Usage:   "The FQDN Hostname to check the DNSSEC Status",
 			},
+			&cli.StringSliceFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Value:   cli.NewStringSlice("A"),
+				Usage:   "Record type to validate, repeat to validate several types independently",
+			},
+			&cli.BoolFlag{
+				Name:  "checking-disabled",
+				Usage: "Set the CD bit so that upstream resolvers return bogus data instead of SERVFAIL",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   "text",
+				Usage:   "Output format: text, explain, json, yaml, dot (Graphviz), svg or nagios",
+			},
+			&cli.DurationFlag{
+				Name:  "sig-warning",
+				Value: 7 * 24 * time.Hour,
+				Usage: "With --output nagios, warn if a signature of the chain expires within this duration",
+			},
+			&cli.DurationFlag{
+				Name:  "sig-critical",
+				Value: 24 * time.Hour,
+				Usage: "With --output nagios, go critical if a signature of the chain expires within this duration",
+			},
+		}, limitFlags...),
+	},
+	{
+		Name:   "dane",
+		Usage:  "Validate the TLSA records of a service and match them against its certificate chain",
+		Action: daneCheck,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "host",
+				Required: true,
+				Usage:    "The hostname of the service",
+			},
+			&cli.UintFlag{
+				Name:  "port",
+				Value: 443,
+				Usage: "The port of the service",
+			},
+			&cli.StringFlag{
+				Name:  "proto",
+				Value: "tcp",
+				Usage: "The transport protocol of the service",
+			},
+			&cli.StringFlag{
+				Name:  "cert",
+				Usage: "Path to the certificate chain of the service, leaf first, in PEM or DER format",
+			},
+			&cli.StringFlag{
+				Name:  "pem",
+				Usage: "The PEM encoded certificate chain of the service, leaf first, if --cert is not given",
+			},
+		},
+	},
+	{
+		Name:   "sshfp",
+		Usage:  "Validate the SSHFP records of a host and compare them against its SSH host keys",
+		Action: sshfpCheck,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "host",
+				Required: true,
+				Usage:    "The hostname of the SSH server",
+			},
+			&cli.StringFlag{
+				Name:  "known-hosts",
+				Usage: "Path to a known_hosts file holding the host keys",
+			},
+			&cli.StringFlag{
+				Name:  "pubkey",
+				Usage: "Path to a public key file holding the host keys, e.g. /etc/ssh/ssh_host_ed25519_key.pub",
+			},
+		},
+	},
+	{
+		Name:      "lint",
+		Usage:     "Audit a zone against DNSSEC best practices",
+		ArgsUsage: "<zone>",
+		Action:    lintZone,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "output",
+				Value: "text",
+				Usage: "Output format, text or json",
+			},
 		},
 	},
+	{
+		Name:      "trace",
+		Usage:     "Print every DNS exchange and validation step made to validate a name",
+		ArgsUsage: "<name>",
+		Action:    traceName,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Value:   cli.NewStringSlice("A"),
+				Usage:   "Record type to validate, repeat to trace several types",
+			},
+			&cli.BoolFlag{
+				Name:  "checking-disabled",
+				Usage: "Set the CD bit so that upstream resolvers return bogus data instead of SERVFAIL",
+			},
+		},
+	},
+	{
+		Name:            "dig",
+		Usage:           "Query a name server like dig +dnssec and annotate each RRset with its validation status",
+		ArgsUsage:       "[@server] [name] [type] [+[no]tcp] [+[no]cd] [+[no]rec]",
+		Action:          digQuery,
+		SkipFlagParsing: true,
+	},
 }
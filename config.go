@@ -4,3 +4,20 @@ const (
 	IndentSpace = 4
 	Version     = "0.0.1"
 )
+
+// Measurement profiles of the measure command
+const (
+	ProfileDNSSEC   = "dnssec"
+	ProfileSMTPDANE = "smtp-dane"
+)
+
+// Exit codes of the query command.  They match the Nagios plugin return
+// codes, an insecure answer being a warning and a bogus one critical.
+const (
+	ExitSecure        = 0
+	ExitInsecure      = 1
+	ExitBogus         = 2
+	ExitIndeterminate = 3
+	// ExitError is returned on operational errors such as invalid flags.
+	ExitError = 4
+)
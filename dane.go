@@ -0,0 +1,68 @@
+package main
+
+import (
+	"DNSSEC-Validator/resolver"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"math"
+	"os"
+)
+
+// daneCheck fetches the DNSSEC validated TLSA records of a service and
+// matches them against a certificate chain supplied as file or PEM.
+func daneCheck(c *cli.Context) error {
+	host := c.String("host")
+	if c.Uint("port") > math.MaxUint16 {
+		return fmt.Errorf("invalid port %v", c.Uint("port"))
+	}
+	port := uint16(c.Uint("port"))
+	proto := c.String("proto")
+
+	certs, err := readCertificates(c.String("cert"), c.String("pem"))
+	if err != nil {
+		return err
+	}
+
+	rq, err := resolver.NewResolver()
+	if err != nil {
+		return err
+	}
+	records, _, err := rq.LookupTLSA(host, port, proto)
+	if err != nil {
+		return fmt.Errorf("TLSA lookup of %v failed: %w", resolver.TLSAName(host, port, proto), err)
+	}
+
+	fmt.Printf("TLSA records for %v (DNSSEC Secure)\n", resolver.TLSAName(host, port, proto))
+	valid := 0
+	for _, result := range resolver.MatchTLSA(records, certs, host) {
+		status := fmt.Sprintf("fail: %v", result.Err)
+		if result.Valid {
+			valid++
+			status = fmt.Sprintf("match (certificate %v)", result.Certificate)
+		}
+		fmt.Printf("\t%v %v %v %v\n", result.Usage, result.Selector, result.MatchingType, status)
+		fmt.Printf("\t\t%v\n", result.Record)
+	}
+
+	if valid == 0 {
+		return errors.New("no TLSA record matches the certificate chain")
+	}
+	fmt.Printf("%v of %v TLSA records match the certificate chain\n", valid, len(records))
+	return nil
+}
+
+// readCertificates loads the certificate chain from the file at path, or
+// from the inline pemData if no path is given.
+func readCertificates(path string, pemData string) ([]*x509.Certificate, error) {
+	data := []byte(pemData)
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resolver.ParseCertificates(data)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"DNSSEC-Validator/resolver"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/urfave/cli/v2"
+	"net"
+	"strings"
+	"time"
+)
+
+// parseDigArgs parses dig-style arguments: @server, the name, the record
+// type and +[no]tcp, +[no]cd and +[no]rec options.  As with dig, any
+// argument naming a record type is taken as the type, and the root zone
+// NS RRset is queried by default.
+func parseDigArgs(args []string) (string, uint16, resolver.DigOptions, error) {
+	name := "."
+	qtype := dns.TypeNS
+	opts := resolver.DigOptions{Recursion: true}
+	nameSet := false
+
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "@"):
+			opts.Server = strings.TrimPrefix(arg, "@")
+		case strings.HasPrefix(arg, "+"):
+			option := strings.ToLower(strings.TrimPrefix(arg, "+"))
+			enabled := !strings.HasPrefix(option, "no")
+			switch strings.TrimPrefix(option, "no") {
+			case "tcp", "vc":
+				opts.TCP = enabled
+			case "cd", "cdflag":
+				opts.CheckingDisabled = enabled
+			case "rec", "recurse":
+				opts.Recursion = enabled
+			case "dnssec":
+				// The DO bit is always set
+			default:
+				return "", 0, opts, fmt.Errorf("unknown option %v", arg)
+			}
+		default:
+			if t, ok := dns.StringToType[strings.ToUpper(arg)]; ok {
+				qtype = t
+				continue
+			}
+			if strings.ToUpper(arg) == "IN" {
+				continue
+			}
+			if nameSet {
+				return "", 0, opts, fmt.Errorf("unexpected argument %v", arg)
+			}
+			name = arg
+			nameSet = true
+		}
+	}
+	return dns.Fqdn(name), qtype, opts, nil
+}
+
+// digQuery sends a single query in the style of dig +dnssec and prints
+// the response, each RRset of the answer and authority sections followed
+// by its validation status.
+func digQuery(c *cli.Context) error {
+	name, qtype, opts, err := parseDigArgs(c.Args().Slice())
+	if err != nil {
+		return cli.Exit(err, ExitError)
+	}
+
+	rq, err := resolver.NewResolver()
+	if err != nil {
+		return cli.Exit(err, ExitError)
+	}
+	rq.CheckingDisabled = opts.CheckingDisabled
+
+	result, err := rq.Dig(name, qtype, opts)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf(";; connection failed: %v", err), ExitError)
+	}
+	printDigResult(c.Args().Slice(), result)
+	return nil
+}
+
+// printDigResult prints the response like dig does.
+func printDigResult(args []string, result *resolver.DigResult) {
+	msg := result.Msg
+	fmt.Printf("\n; <<>> validator dig %v <<>> %v\n", Version, strings.Join(args, " "))
+	fmt.Printf(";; Got answer:\n")
+	fmt.Printf(";; ->>HEADER<<-%v QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		strings.TrimPrefix(msg.MsgHdr.String(), ";;"), len(msg.Question), len(msg.Answer), len(msg.Ns), len(msg.Extra))
+
+	if opt := msg.IsEdns0(); opt != nil {
+		fmt.Printf("%v\n", opt.String())
+	}
+
+	fmt.Printf("\n;; QUESTION SECTION:\n")
+	for _, q := range msg.Question {
+		fmt.Printf("%v\n", q.String())
+	}
+
+	for _, section := range []resolver.DigSection{resolver.SectionAnswer, resolver.SectionAuthority} {
+		printed := false
+		for _, v := range result.Validations {
+			if v.Section != section {
+				continue
+			}
+			if !printed {
+				fmt.Printf("\n;; %v SECTION:\n", section)
+				printed = true
+			}
+			for _, rr := range v.RRset.RrSet {
+				fmt.Printf("%v\n", rr.String())
+			}
+			for _, rrsig := range v.RRset.RrSigs {
+				fmt.Printf("%v\n", rrsig.String())
+			}
+			if v.Err != nil {
+				fmt.Printf("; validation: %v (%v)\n", v.Status, v.Err)
+			} else {
+				fmt.Printf("; validation: %v\n", v.Status)
+			}
+		}
+	}
+
+	additional := make([]dns.RR, 0, len(msg.Extra))
+	for _, rr := range msg.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			additional = append(additional, rr)
+		}
+	}
+	if len(additional) > 0 {
+		fmt.Printf("\n;; ADDITIONAL SECTION:\n")
+		for _, rr := range additional {
+			fmt.Printf("%v\n", rr.String())
+		}
+	}
+
+	host, port, _ := net.SplitHostPort(result.Server)
+	fmt.Printf("\n;; Query time: %d msec\n", result.RTT.Milliseconds())
+	fmt.Printf(";; SERVER: %v#%v(%v)\n", host, port, host)
+	fmt.Printf(";; WHEN: %v\n", time.Now().Format("Mon Jan 02 15:04:05 MST 2006"))
+	fmt.Printf(";; MSG SIZE  rcvd: %d\n\n", msg.Len())
+}
@@ -1,57 +1,328 @@
 package main
 
 import (
+	"DNSSEC-Validator/resolver"
 	"bufio"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func readFormattedInput(path string) []Record {
+const (
+	resultsFileName    = "results.csv"
+	checkpointFileName = "checkpoint.txt"
+	manifestFileName   = "run.json"
+	rejectedFileName   = "rejected.csv"
+)
+
+const (
+	// flushInterval is the number of rows after which the resultWriter
+	// flushes to disk and records a checkpoint.
+	flushInterval = 1000
+	// flushPeriod is the longest time results stay in memory before
+	// performDNSSECMeasurement flushes them and records a checkpoint.
+	flushPeriod = 10 * time.Second
+)
+
+// resultHeader is the header row of the results CSV.
+var resultHeader = []string{"Domain", "QueryType", "DNSSECExists", "DNSSECValid", "reason", "Algorithms", "Protocols", "KeySizes", "KeyTagCollisions", "FailedZone", "FailedStep", "ExtendedError", "UpstreamExtendedErrors", "UpstreamRcode", "UpstreamBogus", "UpstreamAD", "ADDisagreement", "DANEStatus", "DANEDetails", "CDSState", "Bootstrap", "BootstrapSignals", "Misconfigurations", "NSConsistency"}
+
+// runManifest records the options of a measure run, which are reused
+// when it is resumed so that every row of its results is measured the
+// same way.  Input is an absolute path.
+type runManifest struct {
+	Input   string   `json:"input"`
+	Profile string   `json:"profile"`
+	Types   []string `json:"types"`
+	// DomainColumn and Header describe a CSV input, see newInputList.
+	DomainColumn string `json:"domainColumn,omitempty"`
+	Header       bool   `json:"header,omitempty"`
+	// Ordered writes the results in input order, with a Line column.
+	Ordered bool `json:"ordered,omitempty"`
+	// KeepDuplicates measures names listed more than once every time.
+	KeepDuplicates bool `json:"keepDuplicates,omitempty"`
+	// The measurement options, see MeasurementConfig.
+	Limits           resolver.Limits `json:"limits"`
+	CheckingDisabled bool            `json:"checkingDisabled"`
+	UpstreamVerdict  bool            `json:"upstreamVerdict,omitempty"`
+	CompareAD        bool            `json:"compareAD,omitempty"`
+	CheckCDS         bool            `json:"cds,omitempty"`
+	CheckBootstrap   bool            `json:"bootstrap,omitempty"`
+	Diagnose         bool            `json:"diagnose,omitempty"`
+	NSConsistency    bool            `json:"nsConsistency,omitempty"`
+}
+
+// resultWriter writes Records to the results CSV of a run directory as
+// they complete.  Along with the rows, it appends the input line numbers
+// of the entries whose results are on disk to the checkpoint file, each
+// batch followed by a "# <offset>" line holding the size of the results
+// CSV at that point.  A run resumed from the checkpoint truncates the CSV
+// to the last offset, so that the rows of entries measured again are not
+// duplicated.  Entries are identified by their line rather than their
+// name, so that every copy of a name kept with --keep-duplicates is
+// measured.
+type resultWriter struct {
+	Dir string
+	// line and passThrough add the input line number and the columns
+	// passed through from the input to the rows.
+	line        bool
+	passThrough bool
+	f           *os.File
+	writer      *csv.Writer
+	checkpoint  *os.File
+	// pending are the lines of the entries written since the last
+	// checkpoint.
+	pending []int
+	rows    int
+}
+
+// newResultWriter creates the run directory with its manifest, results
+// CSV and checkpoint.  columns names the columns passed through from the
+// input.
+func newResultWriter(dir string, manifest runManifest, columns []string) (*resultWriter, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("%v %v", err, dir)
+	}
+	m, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestFileName), append(m, '\n'), 0644); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filepath.Join(dir, resultsFileName))
+	if err != nil {
+		return nil, err
+	}
+	checkpoint, err := os.Create(filepath.Join(dir, checkpointFileName))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &resultWriter{Dir: dir, f: f, writer: csv.NewWriter(f), checkpoint: checkpoint}
+	w.setColumns(manifest)
+	header := append([]string{}, resultHeader...)
+	if w.line {
+		header = append(header, "Line")
+	}
+	header = append(header, columns...)
+	if err := w.writer.Write(header); err != nil {
+		w.close()
+		return nil, err
+	}
+	if err := w.flush(); err != nil {
+		w.close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// readManifest reads the manifest of the run directory.
+func readManifest(dir string) (runManifest, error) {
+	var manifest runManifest
+	m, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(m, &manifest); err != nil {
+		return manifest, fmt.Errorf("%v: %v", manifestFileName, err)
+	}
+	return manifest, nil
+}
+
+// resumeResultWriter opens the run directory of an interrupted run.  It
+// returns the input lines already measured and drops the rows written after
+// the last checkpoint.
+func resumeResultWriter(dir string, manifest runManifest) (*resultWriter, map[int]bool, error) {
+	checkpointPath := filepath.Join(dir, checkpointFileName)
+	completed, offset, err := readCheckpoint(checkpointPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, resultsFileName), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	checkpoint, err := os.OpenFile(checkpointPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	w := &resultWriter{Dir: dir, f: f, writer: csv.NewWriter(f), checkpoint: checkpoint}
+	w.setColumns(manifest)
+	return w, completed, nil
+}
+
+// readCheckpoint returns the input lines recorded in the checkpoint file
+// and the last offset of the results CSV.  Lines after the last offset,
+// left by a run killed while checkpointing, are ignored.
+func readCheckpoint(path string) (map[int]bool, int64, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("[ERROR] %v", err)
+		return nil, 0, err
 	}
 	defer f.Close()
 
+	completed := make(map[int]bool)
+	batch := make([]int, 0)
+	offset := int64(-1)
 	scanner := bufio.NewScanner(f)
-	records := make([]Record, 0)
 	for scanner.Scan() {
-		records = append(records, Record{
-			Domain: fmt.Sprintf("%v.", scanner.Text()),
-		})
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "# ") {
+			l, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%v: invalid line number %q", path, line)
+			}
+			batch = append(batch, l)
+			continue
+		}
+		o, err := strconv.ParseInt(strings.TrimPrefix(line, "# "), 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%v: invalid offset %q", path, line)
+		}
+		offset = o
+		for _, l := range batch {
+			completed[l] = true
+		}
+		batch = batch[:0]
 	}
 	if err := scanner.Err(); err != nil {
-		log.Fatalf("[Scanner ERROR] %v", err)
+		return nil, 0, err
+	}
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("%v: no checkpoint recorded", path)
+	}
+	return completed, offset, nil
+}
+
+// setColumns selects the optional columns of the rows.
+func (w *resultWriter) setColumns(manifest runManifest) {
+	w.line = manifest.Ordered
+	w.passThrough = manifest.DomainColumn != ""
+}
+
+// Write appends the Records measured for an input entry to the CSV.
+func (w *resultWriter) Write(m measurement) error {
+	for _, r := range m.Results {
+		row := recordRow(r)
+		if w.line {
+			row = append(row, strconv.Itoa(m.Input.Line))
+		}
+		if w.passThrough {
+			row = append(row, m.Input.Columns...)
+		}
+		if err := w.writer.Write(row); err != nil {
+			return err
+		}
 	}
-	return records
+	w.pending = append(w.pending, m.Input.Line)
+	w.rows += len(m.Results)
+	if w.rows >= flushInterval {
+		return w.flush()
+	}
+	return nil
 }
 
-func writeToDisk(results []Record, dirPath string) {
-	err := os.MkdirAll(dirPath, os.ModePerm)
+// Checkpoint flushes the rows written since the last checkpoint, if any.
+func (w *resultWriter) Checkpoint() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	return w.flush()
+}
+
+// flush writes the buffered rows to the CSV, then records the pending
+// lines and the new size of the CSV in the checkpoint.
+func (w *resultWriter) flush() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	offset, err := w.f.Seek(0, io.SeekCurrent)
 	if err != nil {
-		log.Fatalf("[ERROR] %v %v", err, dirPath)
+		return err
 	}
-	filePath := fmt.Sprintf("%v/results-%v.csv", dirPath, time.Now().Unix())
-	f, _ := os.Create(filePath)
-	writer := csv.NewWriter(f)
-	writer.Write([]string{"Domain", "DNSSECExists", "DNSSECValid", "reason", "Algorithms", "Protocols", "KeySizes"})
-	for _, r := range results {
-		row := []string{
-			r.Domain,
-			strconv.FormatBool(r.DNSSECExists),
-			strconv.FormatBool(r.DNSSECValid),
-			r.reason,
-			r.AlgorithmsUsed,
-			r.ProtocolsUsed,
-			r.PublicKeySizes,
-		}
-		writer.Write(row)
+
+	var b strings.Builder
+	for _, l := range w.pending {
+		fmt.Fprintf(&b, "%d\n", l)
+	}
+	fmt.Fprintf(&b, "# %d\n", offset)
+	if _, err := w.checkpoint.WriteString(b.String()); err != nil {
+		return err
+	}
+	if err := w.checkpoint.Sync(); err != nil {
+		return err
+	}
+	w.pending = w.pending[:0]
+	w.rows = 0
+	return nil
+}
+
+// Close records a last checkpoint and closes the files.
+func (w *resultWriter) Close() error {
+	err := w.flush()
+	if closeErr := w.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (w *resultWriter) close() error {
+	err := w.f.Close()
+	if checkpointErr := w.checkpoint.Close(); err == nil {
+		err = checkpointErr
+	}
+	return err
+}
+
+// recordRow formats a Record as a row of the results CSV, in the order
+// of resultHeader.
+func recordRow(r Record) []string {
+	return []string{
+		r.Domain,
+		r.QueryType,
+		strconv.FormatBool(r.DNSSECExists),
+		strconv.FormatBool(r.DNSSECValid),
+		r.reason,
+		r.AlgorithmsUsed,
+		r.ProtocolsUsed,
+		r.PublicKeySizes,
+		r.KeyTagCollisions,
+		r.FailedZone,
+		r.FailedStep,
+		r.ExtendedError,
+		r.UpstreamExtendedErrors,
+		r.UpstreamRcode,
+		r.UpstreamBogus,
+		r.UpstreamAD,
+		r.ADDisagreement,
+		r.DANEStatus,
+		r.DANEDetails,
+		r.CDSState,
+		r.Bootstrap,
+		r.BootstrapSignals,
+		r.Misconfigurations,
+		r.NSConsistency,
 	}
-	writer.Flush()
-	f.Close()
-	fmt.Printf("Successfully wrote output to %v", filePath)
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"DNSSEC-Validator/resolver"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+const (
+	svgFontSize   = 12
+	svgCharWidth  = 7
+	svgNodeHeight = 28
+	svgNodeGap    = 24
+	svgRowHeight  = 72
+	svgPadding    = 16
+	svgZoneTitle  = 20
+)
+
+// edgeColors are the colours of the edges by validation result, close to
+// the ones used by DNSViz.
+var edgeColors = map[resolver.EdgeStatus]string{
+	resolver.EdgeValid:       "#0a6ebd",
+	resolver.EdgeInvalid:     "#d62728",
+	resolver.EdgeExpired:     "#ff7f0e",
+	resolver.EdgeNotYetValid: "#ff7f0e",
+	resolver.EdgeUnverified:  "#7f7f7f",
+}
+
+// edgeStatuses lists the EdgeStatus values in a stable order.
+var edgeStatuses = []resolver.EdgeStatus{
+	resolver.EdgeValid,
+	resolver.EdgeInvalid,
+	resolver.EdgeExpired,
+	resolver.EdgeNotYetValid,
+	resolver.EdgeUnverified,
+}
+
+// writeDOT writes the graph in the Graphviz DOT language, with one
+// cluster per Zone.
+func writeDOT(w io.Writer, name string, g *resolver.ChainGraph) {
+	fmt.Fprintf(w, "digraph %q {\n", name)
+	fmt.Fprintf(w, "\tcompound=true;\n\trankdir=TB;\n")
+	fmt.Fprintf(w, "\tnode [fontname=\"Helvetica\", fontsize=10];\n")
+	fmt.Fprintf(w, "\tedge [fontname=\"Helvetica\", fontsize=8];\n")
+	for i, zone := range g.Zones {
+		fmt.Fprintf(w, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "\t\tlabel=%q;\n", zone)
+		for _, n := range g.NodesOf(zone) {
+			fmt.Fprintf(w, "\t\t%v [label=%q, %v];\n", n.ID, n.Label, dotNodeStyle(n.Kind))
+		}
+		fmt.Fprintf(w, "\t}\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(w, "\t%v -> %v [label=%q, color=%q, fontcolor=%q];\n", e.From, e.To, e.Label, edgeColors[e.Status], edgeColors[e.Status])
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// dotNodeStyle returns the DOT attributes of a node of the kind.
+func dotNodeStyle(kind resolver.GraphNodeKind) string {
+	switch kind {
+	case resolver.NodeDs:
+		return "shape=ellipse, style=filled, fillcolor=\"#f0f0f0\""
+	case resolver.NodeAnswer:
+		return "shape=box, style=rounded"
+	case resolver.NodeMissing:
+		return "shape=ellipse, style=dashed, color=\"#d62728\""
+	default:
+		return "shape=ellipse"
+	}
+}
+
+// svgNode is a node placed in the SVG drawing.
+type svgNode struct {
+	x, y, w, h int
+	// r is the row the node is placed in.
+	r int
+}
+
+// writeSVG draws the graph as SVG without depending on Graphviz.  Zones
+// are stacked from the root down, each with a row of DS records, a row of
+// DNSKEYs and, for the last Zone, a row with the answer RRset.
+func writeSVG(w io.Writer, g *resolver.ChainGraph) {
+	rows := make([][]resolver.GraphNode, 0)
+	rowZones := make([]int, 0)
+	for i, zone := range g.Zones {
+		for _, kind := range []resolver.GraphNodeKind{resolver.NodeDs, resolver.NodeDnskey, resolver.NodeAnswer} {
+			row := make([]resolver.GraphNode, 0)
+			for _, n := range g.NodesOf(zone) {
+				if n.Kind == kind || (kind == resolver.NodeDnskey && n.Kind == resolver.NodeMissing) {
+					row = append(row, n)
+				}
+			}
+			if len(row) > 0 {
+				rows = append(rows, row)
+				rowZones = append(rowZones, i)
+			}
+		}
+	}
+
+	width := 0
+	for _, row := range rows {
+		if rw := rowWidth(row); rw > width {
+			width = rw
+		}
+	}
+	width += 4 * svgPadding
+
+	placed := make(map[string]svgNode)
+	zoneTop := make(map[int]int)
+	zoneBottom := make(map[int]int)
+	y := svgPadding
+	for i, row := range rows {
+		if i == 0 || rowZones[i] != rowZones[i-1] {
+			if i > 0 {
+				y += svgPadding
+			}
+			zoneTop[rowZones[i]] = y
+			y += svgZoneTitle
+		}
+		x := (width - rowWidth(row)) / 2
+		for _, n := range row {
+			nw := nodeWidth(n)
+			placed[n.ID] = svgNode{x: x, y: y + (svgRowHeight-svgNodeHeight)/2, w: nw, h: svgNodeHeight, r: i}
+			x += nw + svgNodeGap
+		}
+		y += svgRowHeight
+		zoneBottom[rowZones[i]] = y
+	}
+	height := y + svgPadding
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"Helvetica, Arial, sans-serif\" font-size=\"%d\">\n", width, height, svgFontSize)
+	fmt.Fprintf(w, "<defs>\n")
+	for _, status := range edgeStatuses {
+		fmt.Fprintf(w, "<marker id=\"arrow-%v\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"8\" markerHeight=\"8\" orient=\"auto\"><path d=\"M0,0 L10,5 L0,10 z\" fill=\"%v\"/></marker>\n", markerID(status), edgeColors[status])
+	}
+	fmt.Fprintf(w, "</defs>\n")
+
+	for i, zone := range g.Zones {
+		top, ok := zoneTop[i]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"6\" fill=\"#fafafa\" stroke=\"#999999\"/>\n", svgPadding, top, width-2*svgPadding, zoneBottom[i]-top)
+		fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\" font-weight=\"bold\">%v</text>\n", 2*svgPadding, top+svgFontSize+4, html.EscapeString(zone))
+	}
+
+	for _, e := range g.Edges {
+		from, to := placed[e.From], placed[e.To]
+		color := edgeColors[e.Status]
+		var path string
+		var lx, ly int
+		switch {
+		case e.From == e.To:
+			x, y := from.x+from.w, from.y+from.h/2
+			path = fmt.Sprintf("M%d,%d C%d,%d %d,%d %d,%d", x, y-6, x+30, y-24, x+30, y+24, x, y+6)
+			lx, ly = x+32, y
+		case from.r == to.r:
+			x1, x2 := from.x+from.w/2, to.x+to.w/2
+			y1 := from.y
+			bend := y1 - svgRowHeight/3
+			path = fmt.Sprintf("M%d,%d Q%d,%d %d,%d", x1, y1, (x1+x2)/2, bend, x2, y1)
+			lx, ly = (x1+x2)/2, bend+svgFontSize/2
+		default:
+			x1, y1 := from.x+from.w/2, from.y+from.h
+			x2, y2 := to.x+to.w/2, to.y
+			if from.r > to.r {
+				y1, y2 = from.y, to.y+to.h
+			}
+			path = fmt.Sprintf("M%d,%d L%d,%d", x1, y1, x2, y2)
+			lx, ly = (x1+x2)/2+4, (y1+y2)/2
+		}
+		fmt.Fprintf(w, "<path d=\"%v\" fill=\"none\" stroke=\"%v\" stroke-width=\"1.5\" marker-end=\"url(#arrow-%v)\"/>\n", path, color, markerID(e.Status))
+		fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\" font-size=\"%d\" fill=\"%v\">%v</text>\n", lx, ly, svgFontSize-3, color, html.EscapeString(e.Label))
+	}
+
+	for _, row := range rows {
+		for _, n := range row {
+			p := placed[n.ID]
+			stroke, fill, dash := "#333333", "#ffffff", ""
+			switch n.Kind {
+			case resolver.NodeDs:
+				fill = "#f0f0f0"
+			case resolver.NodeMissing:
+				stroke, dash = edgeColors[resolver.EdgeInvalid], " stroke-dasharray=\"4,3\""
+			}
+			rx := p.h / 2
+			if n.Kind == resolver.NodeAnswer {
+				rx = 4
+			}
+			fmt.Fprintf(w, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"%d\" fill=\"%v\" stroke=\"%v\"%v/>\n", p.x, p.y, p.w, p.h, rx, fill, stroke, dash)
+			fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%v</text>\n", p.x+p.w/2, p.y+p.h/2+svgFontSize/2-2, html.EscapeString(n.Label))
+		}
+	}
+	fmt.Fprintf(w, "</svg>\n")
+}
+
+// nodeWidth estimates the width of the node from the length of its label.
+func nodeWidth(n resolver.GraphNode) int {
+	return len(n.Label)*svgCharWidth + 2*svgPadding
+}
+
+// rowWidth returns the width of a row of nodes including the gaps.
+func rowWidth(row []resolver.GraphNode) int {
+	width := 0
+	for i, n := range row {
+		if i > 0 {
+			width += svgNodeGap
+		}
+		width += nodeWidth(n)
+	}
+	return width
+}
+
+// markerID turns an EdgeStatus into an identifier usable in SVG.
+func markerID(status resolver.EdgeStatus) string {
+	return strings.ReplaceAll(string(status), " ", "-")
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"golang.org/x/net/idna"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// rejectedHeader is the header row of the rejected entries CSV.
+var rejectedHeader = []string{"Line", "Input", "Reason"}
+
+// inputList reads the names to measure, either from a plain list with a
+// name per line or from a CSV file with the names in one of its columns.
+// The other columns of a CSV file are passed through to the results.
+type inputList struct {
+	scanner *bufio.Scanner
+	reader  *csv.Reader
+	// domainColumn is the 0-based index of the names in the CSV rows.
+	domainColumn int
+	// Columns names the columns passed through to the results, in the
+	// order of the input.  It is empty for plain lists.
+	Columns []string
+	// first is the first row of a CSV file without header, read ahead
+	// to count its columns.
+	first []string
+	line  int
+	// keepDuplicates sends every copy of a name listed more than once.
+	keepDuplicates bool
+}
+
+// newInputList prepares to read input as described by the manifest.
+// Without DomainColumn, input is a plain list.  Otherwise it is a CSV
+// file and DomainColumn is either the 1-based index of the column of the
+// names or the name of that column in the header row.  The header row
+// is also skipped if Header is set; without one, the columns passed
+// through are named Column<index>.
+func newInputList(input io.Reader, manifest runManifest) (*inputList, error) {
+	if manifest.DomainColumn == "" {
+		return &inputList{scanner: bufio.NewScanner(input), keepDuplicates: manifest.KeepDuplicates}, nil
+	}
+
+	l := &inputList{reader: csv.NewReader(input), keepDuplicates: manifest.KeepDuplicates}
+	l.reader.TrimLeadingSpace = true
+	index, err := strconv.Atoi(manifest.DomainColumn)
+	byName := err != nil
+	if !byName && index < 1 {
+		return nil, fmt.Errorf("invalid domain column %v, columns are numbered from 1", index)
+	}
+
+	row, err := l.reader.Read()
+	if err == io.EOF {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	header := byName || manifest.Header
+	if byName {
+		index = 0
+		for i, name := range row {
+			if name == manifest.DomainColumn {
+				index = i + 1
+				break
+			}
+		}
+		if index == 0 {
+			return nil, fmt.Errorf("no column %v in the header of the input", manifest.DomainColumn)
+		}
+	}
+	if index > len(row) {
+		return nil, fmt.Errorf("domain column %v out of range, the input has %v columns", index, len(row))
+	}
+	l.domainColumn = index - 1
+
+	for i, name := range row {
+		if i == l.domainColumn {
+			continue
+		}
+		if !header {
+			name = fmt.Sprintf("Column%d", i+1)
+		}
+		l.Columns = append(l.Columns, name)
+	}
+	if !header {
+		l.first = row
+	}
+	return l, nil
+}
+
+// next returns the Record of the next entry of the input, or io.EOF.
+// The Domain of the Record is the entry as read.  A CSV row with a
+// different number of fields than the first is returned along with an
+// error wrapping csv.ErrFieldCount.
+func (l *inputList) next() (Record, error) {
+	if l.reader == nil {
+		if !l.scanner.Scan() {
+			if err := l.scanner.Err(); err != nil {
+				return Record{}, err
+			}
+			return Record{}, io.EOF
+		}
+		l.line++
+		return Record{Domain: l.scanner.Text(), Line: l.line}, nil
+	}
+
+	row := l.first
+	l.first = nil
+	if row == nil {
+		var err error
+		row, err = l.reader.Read()
+		if errors.Is(err, csv.ErrFieldCount) {
+			line, _ := l.reader.FieldPos(0)
+			return Record{Domain: strings.Join(row, ","), Line: line}, err
+		}
+		if err != nil {
+			return Record{}, err
+		}
+	}
+	line, _ := l.reader.FieldPos(0)
+	columns := make([]string, 0, len(row)-1)
+	columns = append(columns, row[:l.domainColumn]...)
+	columns = append(columns, row[l.domainColumn+1:]...)
+	return Record{Domain: row[l.domainColumn], Line: line, Columns: columns}, nil
+}
+
+// Read sends a Record for every entry of the input to records as it
+// reads it, and closes records when it returns.  The names are
+// normalized with normalizeName; entries that cannot be, and the
+// duplicates unless KeepDuplicates was set in the manifest, are written
+// to rejected with the reason.  The entries whose line is in completed
+// are skipped.  Sending blocks while records is full, so that
+// only as much of the input as the channel buffers is held in memory.
+// If window is not nil, a slot of it is taken for every Record sent,
+// which bounds the number of Records in flight when the results are
+// written in order.  Reading stops early once done is closed.
+func (l *inputList) Read(records chan<- Record, completed map[int]bool, window chan<- struct{}, rejected *csv.Writer, done <-chan struct{}) error {
+	defer close(records)
+	defer rejected.Flush()
+
+	reject := func(r Record, reason string) error {
+		return rejected.Write([]string{strconv.Itoa(r.Line), r.Domain, reason})
+	}
+	if err := rejected.Write(rejectedHeader); err != nil {
+		return err
+	}
+
+	// seen maps the names read to the line they first appeared on
+	seen := make(map[string]int)
+	seq := 0
+	for {
+		r, err := l.next()
+		if err == io.EOF {
+			rejected.Flush()
+			return rejected.Error()
+		}
+		if errors.Is(err, csv.ErrFieldCount) {
+			if err := reject(r, fmt.Sprintf("expected %d fields", len(l.Columns)+1)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		domain, err := normalizeName(r.Domain)
+		if err != nil {
+			if err := reject(r, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if !l.keepDuplicates {
+			if line, ok := seen[domain]; ok {
+				if err := reject(r, fmt.Sprintf("duplicate of line %d", line)); err != nil {
+					return err
+				}
+				continue
+			}
+			seen[domain] = r.Line
+		}
+		r.Domain = domain
+
+		if completed[r.Line] {
+			continue
+		}
+		r.seq = seq
+		seq++
+		if window != nil {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return nil
+			}
+		}
+		select {
+		case records <- r:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// idnaProfile converts internationalized names to their A-label form
+// following IDNA2008 with the UTS #46 mapping used by browsers, which
+// also lowercases them.  Underscores are allowed for names such as
+// _25._tcp.mail.example.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// schemePattern matches a URL scheme (RFC 3986) that cannot be taken for
+// a host name.
+var schemePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+-]*$`)
+
+// isPort returns true if s is a port number.
+func isPort(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
+
+// normalizeName turns an entry of the input into a lowercase, fully
+// qualified name in A-label form.  Surrounding whitespace, a URL scheme,
+// user info, port, path, query and fragment, and a trailing dot are
+// stripped.  Entries that do not hold a valid host name are rejected
+// with an error describing why.
+func normalizeName(entry string) (string, error) {
+	name := strings.TrimSpace(entry)
+	if name == "" {
+		return "", errors.New("empty line")
+	}
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+len("://"):]
+	}
+	if i := strings.IndexAny(name, "/?#"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name = name[i+1:]
+	}
+	if strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+		return "", errors.New("whitespace in name")
+	}
+	if net.ParseIP(strings.Trim(name, "[]")) != nil {
+		return "", errors.New("IP address instead of name")
+	}
+	if i := strings.Index(name, ":"); i >= 0 && schemePattern.MatchString(name[:i]) && !isPort(name[i+1:]) {
+		return "", fmt.Errorf("URL scheme %v: without //", name[:i])
+	}
+	if host, port, err := net.SplitHostPort(name); err == nil {
+		if !isPort(port) {
+			return "", fmt.Errorf("invalid port %q", port)
+		}
+		name = host
+		if net.ParseIP(name) != nil {
+			return "", errors.New("IP address instead of name")
+		}
+	}
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return "", errors.New("empty name")
+	}
+
+	name, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid IDN: %v", err)
+	}
+	name = strings.ToLower(name)
+	if len(name) > 253 {
+		return "", errors.New("name longer than 253 octets")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return "", errors.New("empty label")
+		}
+		if len(label) > 63 {
+			return "", fmt.Errorf("label %v longer than 63 octets", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return "", fmt.Errorf("invalid character %q", c)
+			}
+		}
+	}
+	return name + ".", nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestNormalizeName(t *testing.T) {
+	for _, test := range []struct {
+		entry string
+		name  string
+		valid bool
+	}{
+		{"Example.COM", "example.com.", true},
+		{"example.com.", "example.com.", true},
+		{" https://user@WWW.Example.com:8443/path?q#f ", "www.example.com.", true},
+		{"example.com:443", "example.com.", true},
+		{"_25._tcp.mail.example", "_25._tcp.mail.example.", true},
+		{"bücher.de", "xn--bcher-kva.de.", true},
+		{"BÜCHER.de", "xn--bcher-kva.de.", true},
+		{"xn--bcher-kva.de", "xn--bcher-kva.de.", true},
+		// Deviation characters are kept by IDNA2008 instead of being
+		// mapped as in IDNA2003
+		{"faß.de", "xn--fa-hia.de.", true},
+		{"ß.de", "xn--zca.de.", true},
+		{"http://例え.テスト/", "xn--r8jz45g.xn--zckzah.", true},
+		{"", "", false},
+		{".", "", false},
+		{"a..b", "", false},
+		{"a b.com", "", false},
+		{"192.0.2.1", "", false},
+		{"192.0.2.1:53", "", false},
+		{"[2001:db8::1]:53", "", false},
+		{"2001:db8::1", "", false},
+		{"http:example.com", "", false},
+		{"example.com:abc", "", false},
+		{"example.com:65536", "", false},
+		{"ex*ample.com", "", false},
+		{"xn--zz.com", "", false},
+	} {
+		name, err := normalizeName(test.entry)
+		if test.valid && (err != nil || name != test.name) {
+			t.Errorf("normalizeName(%q) = %q, %v, want %q", test.entry, name, err, test.name)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("normalizeName(%q) = %q, want an error", test.entry, name)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"DNSSEC-Validator/resolver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"strings"
+)
+
+// lintReport is the JSON output of the lint command.
+type lintReport struct {
+	Zone     string                 `json:"zone"`
+	Findings []resolver.LintFinding `json:"findings"`
+}
+
+// lintZone runs the DNSSEC best practice rules against the zone given as
+// argument and prints the findings as text or JSON.
+func lintZone(c *cli.Context) error {
+	zone := c.Args().First()
+	if zone == "" {
+		return errors.New("usage: lint <zone>")
+	}
+
+	rq, err := resolver.NewResolver()
+	if err != nil {
+		return err
+	}
+	findings, _, err := rq.Lint(zone)
+	if err != nil {
+		return err
+	}
+
+	switch c.String("output") {
+	case "json":
+		data, err := json.MarshalIndent(lintReport{Zone: zone, Findings: findings}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "text":
+		if len(findings) == 0 {
+			fmt.Printf("%v: no findings\n", zone)
+		}
+		for _, f := range findings {
+			fmt.Printf("[%v] %v %v: %v\n", strings.ToUpper(string(f.Severity)), f.RuleID, f.Zone, f.Message)
+			fmt.Printf("\t%v\n", f.Explanation)
+		}
+	default:
+		return fmt.Errorf("unknown output format %v", c.String("output"))
+	}
+	return nil
+}
@@ -2,141 +2,796 @@ package main
 
 import (
 	"DNSSEC-Validator/resolver"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/miekg/dns"
 	"github.com/urfave/cli/v2"
 	"log"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-func query(hostname string, dnsQueryType uint16) ([]dns.RR, *resolver.AuthenticationChain, error) {
-	rq, _ := resolver.NewResolver()
-	result, chain, err := rq.StrictNSQuery(hostname, dnsQueryType)
-	if err != nil {
-		// Handle errors
-		return nil, nil, err
+// parseQueryTypes converts RR type mnemonics such as "A" or "TLSA" to
+// their numeric values.
+func parseQueryTypes(names []string) ([]uint16, error) {
+	qtypes := make([]uint16, 0, len(names))
+	for _, name := range names {
+		qtype, ok := dns.StringToType[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown record type %v", name)
+		}
+		qtypes = append(qtypes, qtype)
 	}
-	return result, chain, nil
+	return qtypes, nil
 }
 
-func worker(id int, rq *resolver.Resolver, records <-chan Record, results chan<- Record) {
+// worker validates every QueryType of the Records it receives, emitting
+// one result per Record and type, until records is closed or done is.
+func worker(id int, rq *resolver.Resolver, config MeasurementConfig, records <-chan Record, results chan<- measurement, done <-chan struct{}) {
+	send := func(m measurement) bool {
+		select {
+		case results <- m:
+			return true
+		case <-done:
+			return false
+		}
+	}
 	for r := range records {
-		_, chain, err := rq.StrictNSQuery(r.Domain, dns.TypeA)
-		if err != nil {
-			r := Record{Domain: r.Domain}
-			if err == resolver.ErrInvalidQuery {
-				r.reason = err.Error()
-				r.DNSSECExists = false
-				r.DNSSECValid = false
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if config.Profile == ProfileSMTPDANE {
+			if !send(measurement{Input: r, Results: []Record{measureSMTPDANE(rq, r.Domain)}}) {
+				return
 			}
-			if err == resolver.ErrResourceNotSigned {
-				// Typical base case where there is no DNSSEC
-				r.reason = err.Error()
-				r.DNSSECExists = false
-				r.DNSSECValid = false
+			continue
+		}
+		domainResults := make([]Record, 0, len(config.QueryTypes))
+		domainChains := make([]*resolver.AuthenticationChain, 0, len(config.QueryTypes))
+		failed := make([]bool, 0, len(config.QueryTypes))
+		for _, qtype := range config.QueryTypes {
+			_, upstream, chain, err := rq.QueryChainUpstream(r.Domain, qtype)
+			result := newValidationRecord(r.Domain, qtype, chain, err)
+			if len(upstream) > 0 {
+				result.UpstreamExtendedErrors = serializeUpstreamResponses(upstream)
 			}
-			// All of the following cases hint about DNSSEC but are invalid.
-			if err == resolver.ErrInvalidRRsig || // Invalid RRSIG returned
-				err == resolver.ErrRrsigValidationError || // Signature is invalid
-				err == resolver.ErrRrsigValidityPeriod || // Signature has expired
-				err == resolver.ErrDsInvalid || // Delegation is invalid
-				err == resolver.ErrUnknownDsDigestType || // DigestType is unknown for DS
-				err == resolver.ErrDnskeyNotAvailable || // DNSKEY was hinted but not available
-				err == resolver.ErrDelegationChain {  // Verify was called but with an empty delegation chain.. Should not have happened.
-				r.reason = err.Error()
-				r.DNSSECExists = true
-				r.DNSSECValid = false
-
-				if chain != nil {
-					algorithmsUsed, protocolsUsed, keySizes, err := chain.SerializeKeyAlgorithmsUsed()
-					if err != nil {
-						// There's nothing we can do.
-					} else {
-						algorithms := strings.Join(algorithmsUsed, "|")
-						protocols := strings.Join(protocolsUsed, "|")
-						keySizes := strings.Join(keySizes, "|")
-						r.AlgorithmsUsed = algorithms
-						r.ProtocolsUsed = protocols
-						r.PublicKeySizes = keySizes
-					}
+			if config.CheckCDS && chain != nil && len(chain.DelegationChain) > 0 {
+				addCDSState(rq, &result, &chain.DelegationChain[0])
+			}
+			if config.CheckBootstrap && errors.Is(err, resolver.ErrDsNotAvailable) {
+				// Signed zone without DS at its parent
+				addBootstrapState(rq, &result, result.FailedZone)
+			}
+			if config.NSConsistency && chain != nil {
+				addNSConsistency(rq, &result, chain)
+			}
+			if config.UpstreamVerdict {
+				addUpstreamVerdict(rq, &result, qtype)
+			}
+			if config.CompareAD {
+				compareUpstreamAD(rq, &result, qtype, err)
+			}
+			domainResults = append(domainResults, result)
+			domainChains = append(domainChains, chain)
+			failed = append(failed, err != nil)
+		}
+		if config.Diagnose {
+			addDiagnoses(rq, r.Domain, domainResults, domainChains, failed)
+		}
+		if !send(measurement{Input: r, Results: domainResults}) {
+			return
+		}
+	}
+}
+
+// newValidationRecord builds the measured Record of the qtype RRset of
+// domain from the outcome of its validation.
+func newValidationRecord(domain string, qtype uint16, chain *resolver.AuthenticationChain, err error) Record {
+	if err != nil {
+		r := Record{Domain: domain, QueryType: dns.TypeToString[qtype]}
+		var validationErr *resolver.ValidationError
+		if errors.As(err, &validationErr) {
+			r.FailedZone = validationErr.Zone
+			r.FailedStep = string(validationErr.Step)
+		}
+		if infoCode, ok := resolver.ExtendedErrorFor(err); ok {
+			r.ExtendedError = resolver.ExtendedErrorString(infoCode)
+		}
+		var upstreamErr *resolver.UpstreamError
+		if errors.As(err, &upstreamErr) {
+			// None of the upstreams answered, keep what each of them said
+			r.reason = err.Error()
+			r.UpstreamExtendedErrors = serializeUpstreamResponses(upstreamErr.Responses)
+		}
+		if errors.Is(err, resolver.ErrInvalidQuery) {
+			r.reason = err.Error()
+			r.DNSSECExists = false
+			r.DNSSECValid = false
+		}
+		if errors.Is(err, resolver.ErrResourceNotSigned) {
+			// Typical base case where there is no DNSSEC
+			r.reason = err.Error()
+			r.DNSSECExists = false
+			r.DNSSECValid = false
+		}
+		if errors.Is(err, resolver.ErrNSEC3IterationsExceeded) {
+			// Signed, but denied with too many NSEC3 iterations to be checked
+			r.reason = err.Error()
+			r.DNSSECExists = true
+			r.DNSSECValid = false
+		}
+		// All of the following cases hint about DNSSEC but are invalid.
+		if errors.Is(err, resolver.ErrInvalidRRsig) || // Invalid RRSIG returned
+			errors.Is(err, resolver.ErrRrsigValidationError) || // Signature is invalid
+			errors.Is(err, resolver.ErrRrsigValidityPeriod) || // Signature has expired
+			errors.Is(err, resolver.ErrDsInvalid) || // Delegation is invalid
+			errors.Is(err, resolver.ErrUnknownDsDigestType) || // DigestType is unknown for DS
+			errors.Is(err, resolver.ErrDnskeyNotAvailable) || // DNSKEY was hinted but not available
+			errors.Is(err, resolver.ErrDelegationChain) || // Verify was called but with an empty delegation chain.. Should not have happened.
+			errors.Is(err, resolver.ErrValidationBudgetExceeded) { // Validation was aborted by the resource Limits
+			r.reason = err.Error()
+			r.DNSSECExists = true
+			r.DNSSECValid = false
+
+			if chain != nil {
+				algorithmsUsed, protocolsUsed, keySizes, err := chain.SerializeKeyAlgorithmsUsed()
+				if err != nil {
+					// There's nothing we can do.
+				} else {
+					algorithms := strings.Join(algorithmsUsed, "|")
+					protocols := strings.Join(protocolsUsed, "|")
+					keySizes := strings.Join(keySizes, "|")
+					r.AlgorithmsUsed = algorithms
+					r.ProtocolsUsed = protocols
+					r.PublicKeySizes = keySizes
 				}
+				r.KeyTagCollisions = strings.Join(chain.SerializeKeyTagCollisions(), "|")
 			}
-			results <- r
-		} else {
-			algorithmsUsed, protocolsUsed, keySizesUsed, _ := chain.SerializeKeyAlgorithmsUsed()
-
-			algorithms := strings.Join(algorithmsUsed, "|")
-			protocols := strings.Join(protocolsUsed, "|")
-			keySizes := strings.Join(keySizesUsed, "|")
-
-			results <- Record{
-				Domain: r.Domain,
-				DNSSECExists: true,
-				DNSSECValid: true,
-				reason: "",
-				AlgorithmsUsed: algorithms,
-				ProtocolsUsed: protocols,
-				PublicKeySizes: keySizes,
+		}
+		return r
+	}
+
+	algorithmsUsed, protocolsUsed, keySizesUsed, _ := chain.SerializeKeyAlgorithmsUsed()
+
+	algorithms := strings.Join(algorithmsUsed, "|")
+	protocols := strings.Join(protocolsUsed, "|")
+	keySizes := strings.Join(keySizesUsed, "|")
+	collisions := strings.Join(chain.SerializeKeyTagCollisions(), "|")
+
+	return Record{
+		Domain:           domain,
+		QueryType:        dns.TypeToString[qtype],
+		DNSSECExists:     true,
+		DNSSECValid:      true,
+		reason:           "",
+		AlgorithmsUsed:   algorithms,
+		ProtocolsUsed:    protocols,
+		PublicKeySizes:   keySizes,
+		KeyTagCollisions: collisions,
+	}
+}
+
+// measureSMTPDANE validates the MX RRset of domain and records the SMTP
+// DANE readiness of the domain and of each of its MX hosts.
+func measureSMTPDANE(rq *resolver.Resolver, domain string) Record {
+	result := rq.CheckSMTPDANE(domain)
+	r := newValidationRecord(domain, dns.TypeMX, result.MXChain, result.MXErr)
+	r.DANEStatus = string(result.Status)
+
+	details := make([]string, 0, len(result.Hosts))
+	for _, host := range result.Hosts {
+		details = append(details, fmt.Sprintf("%v:%v", host.Host, host.Status))
+	}
+	r.DANEDetails = strings.Join(details, "|")
+	return r
+}
+
+// addCDSState records the state of the CDS and CDNSKEY records of the
+// Zone signing the measured RRset.
+func addCDSState(rq *resolver.Resolver, r *Record, signedZone *resolver.SignedZone) {
+	result := rq.CheckCDS(signedZone)
+	r.CDSState = string(result.State)
+	if result.Err != nil {
+		r.CDSState = fmt.Sprintf("%v: %v", result.State, result.Err)
+	}
+}
+
+// addDiagnoses records the misconfiguration classes found in the chain of
+// every failed validation of the record types of domain, given with their
+// chains.  Unsigned answers come without a chain, in which case the chain
+// of another type of the domain is reused if it covers the domain, or
+// else the chain of every ancestor of the domain is diagnosed, once for
+// all of its types.
+func addDiagnoses(rq *resolver.Resolver, domain string, results []Record, chains []*resolver.AuthenticationChain, failed []bool) {
+	var shared *resolver.AuthenticationChain
+	for _, chain := range chains {
+		if chain != nil && len(chain.DelegationChain) > 0 && dns.IsSubDomain(chain.DelegationChain[0].Zone, domain) {
+			shared = chain
+			break
+		}
+	}
+	var ancestors []resolver.Diagnosis
+	populated := false
+
+	for i := range results {
+		if !failed[i] {
+			continue
+		}
+		var diagnoses []resolver.Diagnosis
+		switch {
+		case chains[i] != nil:
+			diagnoses = chains[i].Diagnose()
+		case shared != nil:
+			diagnoses = shared.Diagnose()
+		default:
+			if !populated {
+				var err error
+				populated = true
+				if ancestors, err = rq.DiagnoseName(domain); err != nil {
+					log.Printf("[%v] diagnose: %v", domain, err)
+				}
 			}
+			diagnoses = ancestors
+		}
+
+		classes := make([]string, 0, len(diagnoses))
+		for _, d := range diagnoses {
+			classes = append(classes, d.String())
 		}
+		results[i].Misconfigurations = strings.Join(classes, "|")
 	}
 }
 
-func performDNSSECMeasurement(records []Record, outBasePath string, workers int) {
-	workerJobs := make(chan Record, len(records))
-	workerJobResults := make(chan Record, len(records))
+// addNSConsistency records, for every Zone of the chain, the differences
+// between the answers of its authoritative servers, formatted as
+// <zone>:consistent or <zone>:<inconsistency>;<inconsistency>.
+func addNSConsistency(rq *resolver.Resolver, r *Record, chain *resolver.AuthenticationChain) {
+	zones := make([]string, 0, len(chain.DelegationChain))
+	for _, zc := range rq.CheckChainNameservers(chain) {
+		if zc.Consistent() {
+			zones = append(zones, fmt.Sprintf("%v:consistent", zc.Zone))
+			continue
+		}
+		zones = append(zones, fmt.Sprintf("%v:%v", zc.Zone, strings.Join(zc.Inconsistencies, ";")))
+	}
+	r.NSConsistency = strings.Join(zones, "|")
+}
+
+// addBootstrapState records whether the zone, signed but without DS at
+// its parent, can be bootstrapped securely (RFC 9615), along with the
+// state of the signal of each of its name servers.
+func addBootstrapState(rq *resolver.Resolver, r *Record, zone string) {
+	result := rq.CheckBootstrap(zone)
+	r.Bootstrap = "bootstrappable"
+	if !result.Bootstrappable {
+		r.Bootstrap = fmt.Sprintf("not bootstrappable: %v", result.Err)
+	}
+
+	signals := make([]string, 0, len(result.Signals))
+	for _, signal := range result.Signals {
+		state := "valid"
+		if !signal.Valid {
+			state = signal.Err.Error()
+		}
+		signals = append(signals, fmt.Sprintf("%v:%v", signal.Nameserver, state))
+	}
+	r.BootstrapSignals = strings.Join(signals, "|")
+}
+
+// addUpstreamVerdict records whether the preferred upstream resolver,
+// queried with checking enabled, judged the qtype RRset of the Record
+// to be bogus.
+func addUpstreamVerdict(rq *resolver.Resolver, r *Record, qtype uint16) {
+	verdict, err := rq.UpstreamVerdict(r.Domain, qtype)
+	if err != nil {
+		log.Printf("[%v] upstream verdict: %v", r.Domain, err)
+		return
+	}
+	r.UpstreamRcode = dns.RcodeToString[verdict.Rcode]
+	r.UpstreamBogus = strconv.FormatBool(verdict.Bogus())
+	if len(verdict.ExtendedErrors) > 0 {
+		// After the responses to the query of the answer
+		serialized := []string{serializeUpstreamResponses([]resolver.UpstreamResponse{*verdict})}
+		if r.UpstreamExtendedErrors != "" {
+			serialized = append([]string{r.UpstreamExtendedErrors}, serialized...)
+		}
+		r.UpstreamExtendedErrors = strings.Join(serialized, "|")
+	}
+}
+
+// compareUpstreamAD records the AD bit and RCODE returned by every
+// upstream resolver for the qtype RRset of the Record, formatted as
+// <server>:<rcode>:AD=<bool> joined by "|", and flags whether any of
+// them disagrees with the local validation result, whose error is err.
+// ADDisagreement is left empty when the local result is indeterminate,
+// as there is then no result to disagree with.
+func compareUpstreamAD(rq *resolver.Resolver, r *Record, qtype uint16, err error) {
+	responses := rq.ProbeUpstreams(r.Domain, qtype)
+	serialized := make([]string, 0, len(responses))
+	disagreement := false
+	for _, u := range responses {
+		serialized = append(serialized, fmt.Sprintf("%v:%v:AD=%v", u.Server, dns.RcodeToString[u.Rcode], u.AuthenticatedData))
+		if u.AuthenticatedData != r.DNSSECValid {
+			disagreement = true
+		}
+	}
+	r.UpstreamAD = strings.Join(serialized, "|")
+	if resolver.StatusOf(err) != resolver.StatusIndeterminate && len(responses) > 0 {
+		r.ADDisagreement = strconv.FormatBool(disagreement)
+	}
+}
+
+// serializeUpstreamResponses formats the RCODE and Extended DNS Errors
+// of every upstream as <server>:<rcode>[:<ede>...] joined by "|".
+func serializeUpstreamResponses(responses []resolver.UpstreamResponse) string {
+	serialized := make([]string, 0, len(responses))
+	for _, u := range responses {
+		serialized = append(serialized, u.String())
+	}
+	return strings.Join(serialized, "|")
+}
+
+// performDNSSECMeasurement measures the names listed in input, except
+// those on the lines in completed, and writes the results to out.  The input is
+// streamed to the workers through a queue of config.QueueSize records
+// and the results of every name are written as soon as they complete, so
+// the memory used does not grow with the size of the list.  With
+// config.Ordered, the results are written in input order instead, and at
+// most config.QueueSize names are in flight so that a slow name does not
+// hold back an unbounded number of results.  On SIGINT or SIGTERM, the
+// results written so far are checkpointed so that the run can be resumed.
+// The reader and the workers are stopped when it returns, in particular
+// on the first error writing the results.
+func performDNSSECMeasurement(input *inputList, out *resultWriter, completed map[int]bool, config MeasurementConfig) error {
+	rejectedFile, err := os.Create(filepath.Join(out.Dir, rejectedFileName))
+	if err != nil {
+		out.Close()
+		return err
+	}
+	defer rejectedFile.Close()
+	rejected := csv.NewWriter(rejectedFile)
 
-	measurementResults := make([]Record, len(records))
+	workerJobs := make(chan Record, config.QueueSize)
+	workerJobResults := make(chan measurement, config.QueueSize)
+	done := make(chan struct{})
+	defer close(done)
 
 	rq, err := resolver.NewResolver()
 	if err != nil {
-		log.Fatalf("[ERROR] %v", err)
+		out.Close()
+		return err
 	}
+	rq.Limits = config.Limits
+	rq.CheckingDisabled = config.CheckingDisabled
 
-	for w := 0; w < workers; w++ {
-		go worker(w, rq, workerJobs, workerJobResults)
+	var workers sync.WaitGroup
+	for w := 0; w < config.Workers; w++ {
+		workers.Add(1)
+		go func(id int) {
+			defer workers.Done()
+			worker(id, rq, config, workerJobs, workerJobResults, done)
+		}(w)
 	}
+	go func() {
+		workers.Wait()
+		close(workerJobResults)
+	}()
 
-	for _, r := range records {
-		workerJobs <- r
+	var window chan struct{}
+	if config.Ordered {
+		window = make(chan struct{}, config.QueueSize)
 	}
+	inputErr := make(chan error, 1)
+	go func() {
+		inputErr <- input.Read(workerJobs, completed, window, rejected, done)
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	// Checkpoint regularly even while the workers are stuck on slow zones
+	ticker := time.NewTicker(flushPeriod)
+	defer ticker.Stop()
 
-	for j := range measurementResults {
-		result := <-workerJobResults
-		measurementResults[j] = result
+	// pending holds the results completed ahead of the next one in
+	// input order
+	pending := make(map[int]measurement)
+	next := 0
+	for finished := false; !finished; {
+		var err error
+		select {
+		case m, ok := <-workerJobResults:
+			switch {
+			case !ok:
+				finished = true
+			case !config.Ordered:
+				err = out.Write(m)
+			default:
+				pending[m.Input.seq] = m
+				for m, ok := pending[next]; ok && err == nil; m, ok = pending[next] {
+					delete(pending, next)
+					err = out.Write(m)
+					<-window
+					next++
+				}
+			}
+		case <-ticker.C:
+			err = out.Checkpoint()
+		case <-interrupt:
+			if err := out.Close(); err != nil {
+				return err
+			}
+			return fmt.Errorf("interrupted, resume the run with --resume %v", out.Dir)
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := <-inputErr; err != nil {
+		return err
 	}
+	fmt.Printf("Successfully wrote output to %v", filepath.Join(out.Dir, resultsFileName))
+	return nil
+}
 
-	close(workerJobs)
+// resumableFlags are the measure flags that may change when a run is
+// resumed; the others are recorded in its manifest.
+var resumableFlags = map[string]bool{"resume": true, "parallelism": true, "queue-size": true}
 
-	writeToDisk(measurementResults, outBasePath)
+// limitsFromFlags reads the limitFlags.  The caps on work must be at
+// least 1, the NSEC3 iteration count must fit in 16 bits.
+func limitsFromFlags(c *cli.Context) (resolver.Limits, error) {
+	limits := resolver.Limits{
+		MaxVerificationsPerRRset: c.Int("max-rrset-verifications"),
+		MaxVerifications:         c.Int("max-verifications"),
+		MaxKeyTagCandidates:      c.Int("max-keytag-candidates"),
+		MaxChainDepth:            c.Int("max-chain-depth"),
+	}
+	caps := []struct {
+		name  string
+		value int
+	}{
+		{"max-rrset-verifications", limits.MaxVerificationsPerRRset},
+		{"max-verifications", limits.MaxVerifications},
+		{"max-keytag-candidates", limits.MaxKeyTagCandidates},
+		{"max-chain-depth", limits.MaxChainDepth},
+	}
+	for _, limit := range caps {
+		if limit.value < 1 {
+			return limits, fmt.Errorf("--%v must be at least 1", limit.name)
+		}
+	}
+	iterations := c.Uint("max-nsec3-iterations")
+	if iterations > math.MaxUint16 {
+		return limits, fmt.Errorf("--max-nsec3-iterations must be at most %v", math.MaxUint16)
+	}
+	limits.MaxNSEC3Iterations = uint16(iterations)
+	return limits, nil
 }
 
+// smtpDANEIgnoredFlags are the measure flags of the dnssec profile, which
+// the smtp-dane profile does not use.
+var smtpDANEIgnoredFlags = []string{"type", "upstream-verdict", "compare-ad", "cds", "bootstrap", "diagnose", "ns-consistency"}
+
 func measure(c *cli.Context) error {
-	inputCsvPath := c.String("inputlist")
-	outputCsvBaseDir := c.String("outdir")
-	parallelismWorkers := c.Int("parallelism")
+	inputPath, err := filepath.Abs(c.String("inputlist"))
+	if err != nil {
+		return err
+	}
+	limits, err := limitsFromFlags(c)
+	if err != nil {
+		return err
+	}
+	manifest := runManifest{
+		Input:            inputPath,
+		Profile:          c.String("profile"),
+		Types:            c.StringSlice("type"),
+		DomainColumn:     c.String("domain-column"),
+		Header:           c.Bool("header"),
+		Ordered:          c.Bool("ordered"),
+		KeepDuplicates:   c.Bool("keep-duplicates"),
+		Limits:           limits,
+		CheckingDisabled: c.Bool("checking-disabled"),
+		UpstreamVerdict:  c.Bool("upstream-verdict"),
+		CompareAD:        c.Bool("compare-ad"),
+		CheckCDS:         c.Bool("cds"),
+		CheckBootstrap:   c.Bool("bootstrap"),
+		Diagnose:         c.Bool("diagnose"),
+		NSConsistency:    c.Bool("ns-consistency"),
+	}
+	resumeDir := c.String("resume")
+	if resumeDir != "" {
+		for _, flag := range c.Command.Flags {
+			name := flag.Names()[0]
+			if !resumableFlags[name] && c.IsSet(name) {
+				return fmt.Errorf("--%v is taken from the run being resumed", name)
+			}
+		}
+		if manifest, err = readManifest(resumeDir); err != nil {
+			return err
+		}
+	}
 
-	records := readFormattedInput(inputCsvPath)
-	performDNSSECMeasurement(records, outputCsvBaseDir, parallelismWorkers)
-	return nil
+	qtypes, err := parseQueryTypes(manifest.Types)
+	if err != nil {
+		return err
+	}
+	config := MeasurementConfig{
+		Workers:          c.Int("parallelism"),
+		QueueSize:        c.Int("queue-size"),
+		Profile:          manifest.Profile,
+		QueryTypes:       qtypes,
+		Ordered:          manifest.Ordered,
+		Limits:           manifest.Limits,
+		CheckingDisabled: manifest.CheckingDisabled,
+		UpstreamVerdict:  manifest.UpstreamVerdict,
+		CompareAD:        manifest.CompareAD,
+		CheckCDS:         manifest.CheckCDS,
+		CheckBootstrap:   manifest.CheckBootstrap,
+		Diagnose:         manifest.Diagnose,
+		NSConsistency:    manifest.NSConsistency,
+	}
+
+	if config.Profile != ProfileDNSSEC && config.Profile != ProfileSMTPDANE {
+		return fmt.Errorf("unknown measurement profile %v", config.Profile)
+	}
+	if config.Profile == ProfileSMTPDANE {
+		for _, name := range smtpDANEIgnoredFlags {
+			if c.IsSet(name) {
+				return fmt.Errorf("--%v does not apply to --profile %v", name, ProfileSMTPDANE)
+			}
+		}
+	}
+
+	if config.Workers < 1 || config.QueueSize < 1 {
+		return fmt.Errorf("--parallelism and --queue-size must be at least 1")
+	}
+
+	f, err := os.Open(manifest.Input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	input, err := newInputList(f, manifest)
+	if err != nil {
+		return err
+	}
+
+	var out *resultWriter
+	var completed map[int]bool
+	if resumeDir != "" {
+		out, completed, err = resumeResultWriter(resumeDir, manifest)
+	} else {
+		runDir := filepath.Join(c.String("outdir"), fmt.Sprintf("run-%v", time.Now().Unix()))
+		out, err = newResultWriter(runDir, manifest, input.Columns)
+	}
+	if err != nil {
+		return err
+	}
+	return performDNSSECMeasurement(input, out, completed, config)
 }
 
+// singleMeasure validates the requested types of a single name.  The
+// exit code reflects the worst SecurityStatus among them, see exitStatus.
 func singleMeasure(c *cli.Context) error {
 	fqdn := c.String("fqdn")
-	_, chain, err := query(fqdn, dns.TypeA)
+	qtypes, err := parseQueryTypes(c.StringSlice("type"))
+	if err != nil {
+		return cli.Exit(err, ExitError)
+	}
+	limits, err := limitsFromFlags(c)
+	if err != nil {
+		return cli.Exit(err, ExitError)
+	}
+	rq, err := resolver.NewResolver()
+	if err != nil {
+		return cli.Exit(err, ExitError)
+	}
+	rq.CheckingDisabled = c.Bool("checking-disabled")
+	rq.Limits = limits
+
+	output := c.String("output")
+	switch output {
+	case "nagios":
+		return nagiosMeasure(fqdn, qtypes, rq, c.Duration("sig-warning"), c.Duration("sig-critical"))
+	case "json", "yaml":
+		errs, err := reportMeasure(fqdn, qtypes, rq, output)
+		if err != nil {
+			return cli.Exit(err, ExitError)
+		}
+		return exitStatus(errs)
+	case "text", "dot", "explain":
+	case "svg":
+		if len(qtypes) > 1 {
+			return cli.Exit("svg output draws a single record type", ExitError)
+		}
+	default:
+		return cli.Exit(fmt.Sprintf("unknown output format %v", output), ExitError)
+	}
+
+	errs := make([]error, 0, len(qtypes))
+	for _, qtype := range qtypes {
+		if output == "explain" {
+			errs = append(errs, explainTypeMeasure(fqdn, qtype, rq))
+			continue
+		}
+		if output != "text" {
+			errs = append(errs, graphTypeMeasure(fqdn, qtype, rq, output))
+			continue
+		}
+		err := singleTypeMeasure(fqdn, qtype, rq)
+		if err != nil {
+			fmt.Printf("%v %v: %v\n\n", fqdn, dns.TypeToString[qtype], err)
+		}
+		errs = append(errs, err)
+	}
+	return exitStatus(errs)
+}
+
+// exitSeverity orders the exit codes of the query command from best to
+// worst.
+var exitSeverity = []int{ExitSecure, ExitInsecure, ExitIndeterminate, ExitBogus, ExitError}
+
+// statusExitCodes maps every SecurityStatus to its exit code.
+var statusExitCodes = map[resolver.SecurityStatus]int{
+	resolver.StatusSecure:        ExitSecure,
+	resolver.StatusInsecure:      ExitInsecure,
+	resolver.StatusBogus:         ExitBogus,
+	resolver.StatusIndeterminate: ExitIndeterminate,
+}
+
+// exitCode returns the exit code of the outcome of a validation: the code
+// of its SecurityStatus, or ExitError if no upstream resolver could be
+// reached.
+func exitCode(err error) int {
+	if errors.Is(err, resolver.ErrNsNotAvailable) {
+		return ExitError
+	}
+	return statusExitCodes[resolver.StatusOf(err)]
+}
+
+// worseExit returns the worse of two exit codes.
+func worseExit(a int, b int) int {
+	for _, code := range exitSeverity {
+		if code == a {
+			return b
+		}
+		if code == b {
+			return a
+		}
+	}
+	return a
+}
+
+// exitStatus returns nil if every validation succeeded.  Otherwise it
+// returns the error of the worst validation with its exitCode, so that
+// scripts can tell insecure, bogus and indeterminate answers and
+// operational errors apart.
+func exitStatus(errs []error) error {
+	code := ExitSecure
+	var worstErr error
+	for _, err := range errs {
+		if worseExit(code, exitCode(err)) != code {
+			code = exitCode(err)
+			worstErr = err
+		}
+	}
+	if worstErr == nil {
+		return nil
+	}
+	return cli.Exit(worstErr, code)
+}
+
+// singleTypeMeasure validates the qtype RRset of fqdn and prints the
+// answer along with its authentication chain.
+func singleTypeMeasure(fqdn string, qtype uint16, rq *resolver.Resolver) error {
+	answer, chain, err := rq.QueryChain(fqdn, qtype)
 	if err != nil {
 		if chain == nil {
 			fmt.Printf("Chain is nil.\n")
 		}
+		var validationErr *resolver.ValidationError
+		if errors.As(err, &validationErr) {
+			fmt.Printf("Validation failed in zone %v at step %v\n", validationErr.Zone, validationErr.Step)
+		}
+		if infoCode, ok := resolver.ExtendedErrorFor(err); ok {
+			fmt.Printf("Extended DNS Error: %v\n", resolver.ExtendedErrorString(infoCode))
+		}
 		return err
 	}
-	fmt.Printf("Valid DNS Record Answer for %v (%v)\n", fqdn, dns.TypeA)
-	//answer := res
-	//for _, a := range answer {
-	//	fmt.Printf("%v\n", a)
-	//}
+	fmt.Printf("Valid DNS Record Answer for %v (%v)\n", fqdn, dns.TypeToString[qtype])
+	for _, a := range answer.RrSet {
+		fmt.Printf("%v\n", a)
+	}
 	fmt.Printf("containing the chain...\n")
+	printChain(chain)
+
+	return nil
+}
+
+// reportMeasure validates every qtype RRset of fqdn and prints the
+// results as a single JSON or YAML document.  The validation error of
+// every type is returned, the error is set if the document could not be
+// written.
+func reportMeasure(fqdn string, qtypes []uint16, rq *resolver.Resolver, output string) ([]error, error) {
+	reports := queryReports{
+		Version: ReportVersion,
+		Results: make([]queryReport, 0, len(qtypes)),
+	}
+	errs := make([]error, 0, len(qtypes))
+	for _, qtype := range qtypes {
+		answer, chain, err := rq.QueryChain(fqdn, qtype)
+		errs = append(errs, err)
+		reports.Results = append(reports.Results, newQueryReport(fqdn, qtype, answer, chain, err))
+	}
+
+	if output == "yaml" {
+		return errs, writeYAML(os.Stdout, reports)
+	}
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return errs, err
+	}
+	fmt.Println(string(data))
+	return errs, nil
+}
+
+// explainTypeMeasure validates the qtype RRset of fqdn and explains the
+// result in plain words, with the suggested remediation.
+func explainTypeMeasure(fqdn string, qtype uint16, rq *resolver.Resolver) error {
+	answer, chain, err := rq.QueryChain(fqdn, qtype)
+	explanation := resolver.Explain(answer, chain, err)
+
+	fmt.Printf("%v %v: %v\n", fqdn, dns.TypeToString[qtype], explanation.Status)
+	for _, line := range explanation.Narrative {
+		fmt.Printf("%v%v\n", strings.Repeat(" ", IndentSpace), line)
+	}
+	if len(explanation.Remediation) > 0 {
+		fmt.Printf("Suggested remediation:\n")
+		for _, line := range explanation.Remediation {
+			fmt.Printf("%v- %v\n", strings.Repeat(" ", IndentSpace), line)
+		}
+	}
+	fmt.Println("")
+	return err
+}
+
+// graphTypeMeasure validates the qtype RRset of fqdn and writes its
+// authentication chain as a DOT or SVG graph to the standard output.
+// The graph is written for failed validations too, as long as the chain
+// could be populated.
+func graphTypeMeasure(fqdn string, qtype uint16, rq *resolver.Resolver, output string) error {
+	answer, chain, err := rq.QueryChain(fqdn, qtype)
+	if chain == nil {
+		return err
+	}
+	g := chain.Graph(answer)
+	if output == "svg" {
+		writeSVG(os.Stdout, g)
+	} else {
+		writeDOT(os.Stdout, fmt.Sprintf("%v %v", fqdn, dns.TypeToString[qtype]), g)
+	}
+	return err
+}
+
+// printChain prints the DelegationChain as an indented text blob.
+func printChain(chain *resolver.AuthenticationChain) {
 	fmt.Printf("-----------------------CHAIN-----------------------\n")
 	zones := chain.DelegationChain
 	for i, sz := range zones {
@@ -166,13 +821,16 @@ func singleMeasure(c *cli.Context) error {
 		fmt.Printf("%v\t\t%v\n", spaceString, sz.Ds.RrSig)
 		fmt.Printf("%v\tKeys      :\n", spaceString)
 		for k, v := range sz.PubKeyLookup {
-			fmt.Printf("%v\t\t %v : %v\n", spaceString, k, v)
+			for _, key := range v {
+				fmt.Printf("%v\t\t %v : %v\n", spaceString, k, key)
+			}
+		}
+		if collisions := sz.KeyTagCollisions(); len(collisions) > 0 {
+			fmt.Printf("%v\tCollisions: %v\n", spaceString, collisions)
 		}
 		fmt.Println("")
 	}
 	fmt.Printf("-------------------END CHAIN-----------------------\n")
-
-	return nil
 }
 
 func main() {
@@ -189,6 +847,7 @@ func main() {
 		},
 	}
 	if err := app.Run(os.Args); err != nil {
-		log.Fatalf("[ERROR] %v\n", err)
+		log.Printf("[ERROR] %v\n", err)
+		os.Exit(ExitError)
 	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"DNSSEC-Validator/resolver"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/urfave/cli/v2"
+	"strings"
+	"time"
+)
+
+// nagiosStates are the Nagios service states by exit code.
+var nagiosStates = map[int]string{
+	ExitSecure:        "OK",
+	ExitInsecure:      "WARNING",
+	ExitBogus:         "CRITICAL",
+	ExitIndeterminate: "UNKNOWN",
+}
+
+// nagiosMeasure validates every qtype RRset of fqdn and prints a single
+// line in the Nagios plugin format, with the chain depth, the shortest
+// remaining signature lifetime and the query time of each type as
+// perfdata.  A signature expiring within warning or critical raises the
+// state even if the answer is secure, hence the warn: and crit: ranges
+// of the lifetime, which alert below the threshold.  Operational errors
+// are reported as UNKNOWN, the only state of the plugin API for them,
+// ranking below CRITICAL.
+func nagiosMeasure(fqdn string, qtypes []uint16, rq *resolver.Resolver, warning time.Duration, critical time.Duration) error {
+	code := ExitSecure
+	summaries := make([]string, 0, len(qtypes))
+	perfdata := make([]string, 0, 3*len(qtypes))
+
+	for _, qtype := range qtypes {
+		typeName := dns.TypeToString[qtype]
+		start := time.Now()
+		answer, chain, err := rq.QueryChain(fqdn, qtype)
+		elapsed := time.Since(start)
+
+		status := resolver.StatusOf(err)
+		typeCode := exitCode(err)
+		summary := fmt.Sprintf("%v %v", typeName, status)
+		if typeCode == ExitError {
+			// UNKNOWN, so that a bogus type still raises CRITICAL
+			typeCode = ExitIndeterminate
+			summary = fmt.Sprintf("%v operational error", typeName)
+		}
+		code = worseExit(code, typeCode)
+		if err != nil {
+			summary = fmt.Sprintf("%v (%v)", summary, err)
+		}
+
+		if chain != nil {
+			perfdata = append(perfdata, fmt.Sprintf("%v_chain_depth=%d", typeName, len(chain.DelegationChain)))
+			if lifetime, ok := chain.SignatureLifetime(answer, time.Now()); ok {
+				perfdata = append(perfdata, fmt.Sprintf("%v_sig_remaining=%ds;%d:;%d:;0", typeName,
+					int64(lifetime.Seconds()), int64(warning.Seconds()), int64(critical.Seconds())))
+				switch {
+				case lifetime < critical:
+					code = worseExit(code, ExitBogus)
+					summary = fmt.Sprintf("%v, signature expires in %v", summary, lifetime.Round(time.Second))
+				case lifetime < warning:
+					code = worseExit(code, ExitInsecure)
+					summary = fmt.Sprintf("%v, signature expires in %v", summary, lifetime.Round(time.Second))
+				}
+			}
+		}
+		perfdata = append(perfdata, fmt.Sprintf("%v_query_time=%.3fs", typeName, elapsed.Seconds()))
+		// The pipe separates the perfdata in the plugin output
+		summaries = append(summaries, strings.ReplaceAll(summary, "|", "/"))
+	}
+
+	fmt.Printf("DNSSEC %v - %v %v | %v\n", nagiosStates[code], fqdn, strings.Join(summaries, "; "), strings.Join(perfdata, " "))
+	return cli.Exit("", code)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"DNSSEC-Validator/resolver"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportVersion is the version of the schema of queryReports.  It is
+// increased whenever a field is renamed or removed.
+const ReportVersion = 1
+
+// queryReports is the JSON and YAML output of the query command.
+type queryReports struct {
+	Version int           `json:"version"`
+	Results []queryReport `json:"results"`
+}
+
+// queryReport is the validation result of one name and record type.
+type queryReport struct {
+	Name            string                  `json:"name"`
+	Type            string                  `json:"type"`
+	Status          resolver.SecurityStatus `json:"status"`
+	Answer          []string                `json:"answer"`
+	AnswerSignature *signatureReport        `json:"answerSignature,omitempty"`
+	Chain           []zoneReport            `json:"chain"`
+	Error           *errorReport            `json:"error,omitempty"`
+}
+
+// zoneReport holds the keys, DS records and signatures of a Zone of the
+// chain of trust.
+type zoneReport struct {
+	Zone            string           `json:"zone"`
+	Dnskeys         []keyReport      `json:"dnskeys"`
+	DnskeySignature *signatureReport `json:"dnskeySignature,omitempty"`
+	Ds              []dsReport       `json:"ds"`
+	DsSignature     *signatureReport `json:"dsSignature,omitempty"`
+}
+
+type keyReport struct {
+	KeyTag    uint16 `json:"keyTag"`
+	Algorithm uint8  `json:"algorithm"`
+	Flags     uint16 `json:"flags"`
+	Role      string `json:"role"`
+	Record    string `json:"record"`
+}
+
+type dsReport struct {
+	KeyTag     uint16 `json:"keyTag"`
+	Algorithm  uint8  `json:"algorithm"`
+	DigestType uint8  `json:"digestType"`
+	Digest     string `json:"digest"`
+	Record     string `json:"record"`
+}
+
+type signatureReport struct {
+	TypeCovered string `json:"typeCovered"`
+	KeyTag      uint16 `json:"keyTag"`
+	Algorithm   uint8  `json:"algorithm"`
+	Signer      string `json:"signer"`
+	Inception   string `json:"inception"`
+	Expiration  string `json:"expiration"`
+	Record      string `json:"record"`
+}
+
+// errorReport details why a validation did not succeed.  Zone, Step and
+// the key fields are only set when a step of the chain of trust failed.
+type errorReport struct {
+	Message       string `json:"message"`
+	Zone          string `json:"zone,omitempty"`
+	Step          string `json:"step,omitempty"`
+	RRType        string `json:"rrType,omitempty"`
+	KeyTag        uint16 `json:"keyTag,omitempty"`
+	Algorithm     uint8  `json:"algorithm,omitempty"`
+	ExtendedError string `json:"extendedError,omitempty"`
+}
+
+// newQueryReport builds the report of a query from the values returned
+// by QueryChain.
+func newQueryReport(name string, qtype uint16, answer *resolver.RRSet, chain *resolver.AuthenticationChain, err error) queryReport {
+	report := queryReport{
+		Name:   name,
+		Type:   dns.TypeToString[qtype],
+		Status: resolver.StatusOf(err),
+		Answer: make([]string, 0),
+		Chain:  make([]zoneReport, 0),
+	}
+	if answer != nil {
+		for _, rr := range answer.RrSet {
+			report.Answer = append(report.Answer, rr.String())
+		}
+		report.AnswerSignature = newSignatureReport(answer)
+	}
+	if chain != nil {
+		for _, sz := range chain.DelegationChain {
+			report.Chain = append(report.Chain, newZoneReport(sz))
+		}
+	}
+	if err != nil {
+		report.Error = &errorReport{Message: err.Error()}
+		var validationErr *resolver.ValidationError
+		if errors.As(err, &validationErr) {
+			report.Error.Zone = validationErr.Zone
+			report.Error.Step = string(validationErr.Step)
+			report.Error.RRType = dns.TypeToString[validationErr.RRType]
+			report.Error.KeyTag = validationErr.KeyTag
+			report.Error.Algorithm = validationErr.Algorithm
+		}
+		if infoCode, ok := resolver.ExtendedErrorFor(err); ok {
+			report.Error.ExtendedError = resolver.ExtendedErrorString(infoCode)
+		}
+	}
+	return report
+}
+
+func newZoneReport(sz resolver.SignedZone) zoneReport {
+	report := zoneReport{
+		Zone:    sz.Zone,
+		Dnskeys: make([]keyReport, 0),
+		Ds:      make([]dsReport, 0),
+	}
+	for _, key := range sz.Keys() {
+		report.Dnskeys = append(report.Dnskeys, keyReport{
+			KeyTag:    key.KeyTag(),
+			Algorithm: key.Algorithm,
+			Flags:     key.Flags,
+			Role:      resolver.KeyRole(key),
+			Record:    key.String(),
+		})
+	}
+	if sz.Dnskey != nil {
+		report.DnskeySignature = newSignatureReport(sz.Dnskey)
+	}
+	if sz.Ds != nil {
+		for _, rr := range sz.Ds.RrSet {
+			if ds, ok := rr.(*dns.DS); ok {
+				report.Ds = append(report.Ds, dsReport{
+					KeyTag:     ds.KeyTag,
+					Algorithm:  ds.Algorithm,
+					DigestType: ds.DigestType,
+					Digest:     strings.ToLower(ds.Digest),
+					Record:     ds.String(),
+				})
+			}
+		}
+		report.DsSignature = newSignatureReport(sz.Ds)
+	}
+	return report
+}
+
+// newSignatureReport returns the report of the RRSIG of the rrset, or nil
+// if it is not signed.
+func newSignatureReport(rrset *resolver.RRSet) *signatureReport {
+	if !rrset.IsSigned() {
+		return nil
+	}
+	rrsig := rrset.RrSig
+	return &signatureReport{
+		TypeCovered: dns.TypeToString[rrsig.TypeCovered],
+		KeyTag:      rrsig.KeyTag,
+		Algorithm:   rrsig.Algorithm,
+		Signer:      rrsig.SignerName,
+		Inception:   time.Unix(int64(rrsig.Inception), 0).UTC().Format(time.RFC3339),
+		Expiration:  time.Unix(int64(rrsig.Expiration), 0).UTC().Format(time.RFC3339),
+		Record:      rrsig.String(),
+	}
+}
+
+// writeYAML writes v as a YAML document.  It supports the types used in
+// the reports: structs with json tags, slices, pointers, strings, integers
+// and booleans, so that no YAML library is needed.
+func writeYAML(w io.Writer, v interface{}) error {
+	fmt.Fprintln(w, "---")
+	return yamlValue(w, reflect.ValueOf(v), 0, false)
+}
+
+// yamlValue writes v at the indentation level.  inline is set when v
+// follows a "- " or "key: " on the current line.
+func yamlValue(w io.Writer, v reflect.Value, indent int, inline bool) error {
+	prefix := strings.Repeat("  ", indent)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			fmt.Fprintln(w, " null")
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := make([]int, 0, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name, omitEmpty := jsonName(field)
+			if name == "-" || field.PkgPath != "" || (omitEmpty && v.Field(i).IsZero()) {
+				continue
+			}
+			fields = append(fields, i)
+		}
+		if len(fields) == 0 {
+			fmt.Fprintln(w, " {}")
+			return nil
+		}
+		if !inline && indent > 0 {
+			fmt.Fprintln(w)
+		}
+		for n, i := range fields {
+			name, _ := jsonName(v.Type().Field(i))
+			if n == 0 && inline {
+				fmt.Fprintf(w, " %v:", name)
+			} else {
+				fmt.Fprintf(w, "%v%v:", prefix, name)
+			}
+			if err := yamlValue(w, v.Field(i), indent+1, false); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.Len() == 0 {
+			fmt.Fprintln(w, " []")
+			return nil
+		}
+		if !inline {
+			fmt.Fprintln(w)
+		}
+		for i := 0; i < v.Len(); i++ {
+			fmt.Fprintf(w, "%v-", prefix)
+			if err := yamlValue(w, v.Index(i), indent+1, true); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		fmt.Fprintf(w, " %v\n", strconv.Quote(v.String()))
+	case reflect.Bool:
+		fmt.Fprintf(w, " %v\n", v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(w, " %v\n", v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fmt.Fprintf(w, " %v\n", v.Uint())
+	default:
+		return fmt.Errorf("cannot write %v as YAML", v.Kind())
+	}
+	return nil
+}
+
+// jsonName returns the name of the field from its json tag, and whether
+// it is tagged omitempty.
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	omitEmpty := false
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	if parts[0] == "" {
+		return field.Name, omitEmpty
+	}
+	return parts[0], omitEmpty
+}
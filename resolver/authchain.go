@@ -2,10 +2,13 @@ package resolver
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/miekg/dns"
 	"log"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // AuthenticationChain represents the DNSSEC chain of trust from the
@@ -16,6 +19,9 @@ import (
 // https://www.ietf.org/rfc/rfc4033.txt
 type AuthenticationChain struct {
 	DelegationChain []SignedZone `json:"chain"`
+	Limits          Limits       `json:"-"`
+	// Tracer receives an event for every step of Verify.
+	Tracer *Tracer `json:"-"`
 }
 
 func (authChain *AuthenticationChain) Serialize() (string, error) {
@@ -48,6 +54,45 @@ func (authChain *AuthenticationChain) SerializeKeyAlgorithmsUsed() ([]string, []
 	return KeyAlgorithms, ProtocolsUsed, KeySizes, nil
 }
 
+// SerializeKeyTagCollisions returns every key tag that is shared by more
+// than one DNSKEY in a Zone of the chain, formatted as <zone>:<keytag>.
+func (authChain *AuthenticationChain) SerializeKeyTagCollisions() []string {
+	collisions := make([]string, 0)
+	for _, sz := range authChain.DelegationChain {
+		for _, keyTag := range sz.KeyTagCollisions() {
+			collisions = append(collisions, fmt.Sprintf("%v:%v", sz.Zone, keyTag))
+		}
+	}
+	return collisions
+}
+
+// SignatureLifetime returns the shortest time left at t until an RRSIG of
+// the chain, or of answer if it is not nil, expires.  It returns false if
+// nothing in the chain is signed.
+func (authChain *AuthenticationChain) SignatureLifetime(answer *RRSet, t time.Time) (time.Duration, bool) {
+	rrsets := make([]*RRSet, 0, 2*len(authChain.DelegationChain)+1)
+	if answer != nil {
+		rrsets = append(rrsets, answer)
+	}
+	for _, sz := range authChain.DelegationChain {
+		rrsets = append(rrsets, sz.Dnskey, sz.Ds)
+	}
+
+	var lifetime time.Duration
+	found := false
+	for _, rrset := range rrsets {
+		if rrset == nil || !rrset.IsSigned() {
+			continue
+		}
+		remaining := signatureRemaining(rrset.RrSig, t)
+		if !found || remaining < lifetime {
+			lifetime = remaining
+			found = true
+		}
+	}
+	return lifetime, found
+}
+
 // Populate queries the RRs required for the Zone validation
 // It begins the queries at the *domainName* Zone and then walks
 // up the delegation tree all the way up to the root Zone, thus
@@ -60,6 +105,9 @@ func (authChain *AuthenticationChain) Populate(domainName string) error {
 	if zonesToVerify < 0 {
 		zonesToVerify = 0
 	}
+	if zonesToVerify > authChain.Limits.MaxChainDepth {
+		return ErrValidationBudgetExceeded
+	}
 
 	authChain.DelegationChain = make([]SignedZone, 0, zonesToVerify)
 	for i := 0; i < zonesToVerify; i++ {
@@ -90,15 +138,19 @@ func (authChain *AuthenticationChain) Verify(answerRRset *RRSet) error {
 		return ErrDelegationChain
 	}
 
+	budget := newValidationBudget(authChain.Limits)
+
 	signedZone := authChain.DelegationChain[0]
 	if !signedZone.checkHasDnskeys() {
-		return ErrDnskeyNotAvailable
+		authChain.trace(signedZone.Zone, StepAnswer, answerRRset, nil, nil, ErrDnskeyNotAvailable)
+		return newValidationError(signedZone.Zone, StepAnswer, answerRRset, ErrDnskeyNotAvailable, nil)
 	}
 
-	err := signedZone.verifyRRSIG(answerRRset)
+	key, err := signedZone.verifyRRSIGKey(answerRRset, budget)
+	authChain.trace(signedZone.Zone, StepAnswer, answerRRset, key, nil, err)
 	if err != nil {
 		//log.Println("RRSIG didn't verify", err)
-		return ErrInvalidRRsig
+		return newValidationError(signedZone.Zone, StepAnswer, answerRRset, validationFailure(err, ErrInvalidRRsig), err)
 	}
 
 	for _, signedZone := range authChain.DelegationChain {
@@ -110,40 +162,94 @@ func (authChain *AuthenticationChain) Verify(answerRRset *RRSet) error {
 
 		if signedZone.Dnskey.IsEmpty() {
 			//log.Printf("DNSKEY RR does not exist on %s\n", signedZone.Zone)
-			return ErrDnskeyNotAvailable
+			authChain.trace(signedZone.Zone, StepDnskey, signedZone.Dnskey, nil, nil, ErrDnskeyNotAvailable)
+			return newValidationError(signedZone.Zone, StepDnskey, signedZone.Dnskey, ErrDnskeyNotAvailable, nil)
 		}
 
 		// Verify the RRSIG of the DNSKEY RRset with the public KSK.
-		err := signedZone.verifyRRSIG(signedZone.Dnskey)
+		key, err := signedZone.verifyRRSIGKey(signedZone.Dnskey, budget)
+		authChain.trace(signedZone.Zone, StepDnskey, signedZone.Dnskey, key, nil, err)
 		if err != nil {
 			//log.Printf("validation DNSKEY: %s\n", err)
-			return ErrRrsigValidationError
+			return newValidationError(signedZone.Zone, StepDnskey, signedZone.Dnskey, validationFailure(err, ErrRrsigValidationError), err)
 		}
 
 		if signedZone.ParentZone != nil {
 
 			if signedZone.Ds.IsEmpty() {
 				//log.Printf("DS RR is not available on zoneName %s\n", signedZone.Zone)
-				return ErrDsNotAvailable
+				authChain.trace(signedZone.Zone, StepDs, signedZone.Ds, nil, nil, ErrDsNotAvailable)
+				return newValidationError(signedZone.Zone, StepDs, signedZone.Ds, ErrDsNotAvailable, nil)
 			}
 
-			err := signedZone.ParentZone.verifyRRSIG(signedZone.Ds)
+			key, err := signedZone.ParentZone.verifyRRSIGKey(signedZone.Ds, budget)
+			authChain.trace(signedZone.Zone, StepDs, signedZone.Ds, key, nil, err)
 			if err != nil {
 				//log.Printf("DS on %s doesn't validate against RRSIG %d\n", signedZone.Zone, signedZone.Ds.RrSig.KeyTag)
-				return ErrRrsigValidationError
+				return newValidationError(signedZone.Zone, StepDs, signedZone.Ds, validationFailure(err, ErrRrsigValidationError), err)
 			}
-			err = signedZone.verifyDS(signedZone.Ds.RrSet)
+			ds, key, err := signedZone.verifyDSKey(signedZone.Ds.RrSet, budget)
+			authChain.trace(signedZone.Zone, StepDelegation, signedZone.Ds, key, ds, err)
 			if err != nil {
 				//log.Printf("DS does not validate: %s", err)
-				return ErrDsInvalid
+				validationErr := newValidationError(signedZone.Zone, StepDelegation, signedZone.Ds, validationFailure(err, ErrDsInvalid), err)
+				if ds != nil {
+					// Report the DS that failed rather than the first one
+					validationErr.KeyTag = ds.KeyTag
+					validationErr.Algorithm = ds.Algorithm
+				}
+				return validationErr
 			}
 		}
 	}
 	return nil
 }
 
+// trace emits the ValidationEvent of a step of Verify to the Tracer.
+func (authChain *AuthenticationChain) trace(zone string, step ValidationStep, rrset *RRSet, key *dns.DNSKEY, ds *dns.DS, err error) {
+	if authChain.Tracer == nil {
+		return
+	}
+	event := &ValidationEvent{
+		Zone: zone,
+		Step: step,
+		Key:  key,
+		Ds:   ds,
+		Err:  err,
+	}
+	if rrset != nil {
+		if rrset.IsSigned() {
+			event.RRType = rrset.RrSig.TypeCovered
+		} else if !rrset.IsEmpty() {
+			event.RRType = rrset.RrSet[0].Header().Rrtype
+		}
+	}
+	authChain.Tracer.emit(TraceEvent{Validation: event})
+}
+
+// validationFailure maps an error returned by the SignedZone methods to
+// the sentinel reported by Verify.  Exhausting the validation budget is
+// reported as such, every other failure as fallback.
+func validationFailure(err error, fallback error) error {
+	if errors.Is(err, ErrValidationBudgetExceeded) {
+		return ErrValidationBudgetExceeded
+	}
+	return fallback
+}
+
+// newAuthenticationChain returns an AuthenticationChain using the Limits
+// and Tracer of the Resolver.
+func (resolver *Resolver) newAuthenticationChain() *AuthenticationChain {
+	authChain := NewAuthenticationChain()
+	authChain.Limits = resolver.Limits
+	authChain.Tracer = resolver.Tracer
+	return authChain
+}
+
 // NewAuthenticationChain initializes an AuthenticationChain object and
 // returns a reference to it.
 func NewAuthenticationChain() *AuthenticationChain {
-	return &AuthenticationChain{}
+	return &AuthenticationChain{
+		Limits: DefaultLimits,
+	}
 }
@@ -0,0 +1,181 @@
+package resolver
+
+import (
+	"errors"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// Errors reported by the authenticated DNSSEC bootstrapping checker.
+var (
+	ErrDsPresent           = errors.New("DS RR already exists at the parent")
+	ErrCdsNotAvailable     = errors.New("neither CDS nor CDNSKEY RR exists at the apex")
+	ErrSignalInBailiwick   = errors.New("name server is below the zone and cannot carry a signal")
+	ErrSignalMismatch      = errors.New("signal does not match the CDS/CDNSKEY RRsets at the apex")
+	ErrSignalNotAvailable  = errors.New("signal RR does not exist")
+	ErrNoNameservers       = errors.New("zone has no NS RRset")
+	ErrBootstrapIncomplete = errors.New("not every name server publishes a valid signal")
+)
+
+// BootstrapSignal is the outcome of checking the signaling records
+// published under the zone of one name server.
+type BootstrapSignal struct {
+	Nameserver string `json:"nameserver"`
+	Name       string `json:"name"`
+	Valid      bool   `json:"valid"`
+	Err        error  `json:"-"`
+}
+
+// BootstrapResult reports whether a Zone that is signed but has no DS at
+// its parent can be bootstrapped securely (RFC 9615).
+type BootstrapResult struct {
+	Zone           string            `json:"zone"`
+	Bootstrappable bool              `json:"bootstrappable"`
+	Signals        []BootstrapSignal `json:"signals"`
+	Err            error             `json:"-"`
+}
+
+// SignalName returns the name under which a name server signals the
+// CDS/CDNSKEY RRsets of zone, _dsboot.<zone>._signal.<nameserver>.
+func SignalName(zone string, nameserver string) string {
+	return "_dsboot." + strings.TrimSuffix(dns.Fqdn(zone), ".") + "._signal." + dns.Fqdn(nameserver)
+}
+
+// CheckBootstrap verifies whether zone can be bootstrapped by authenticated
+// DNSSEC bootstrapping (RFC 9615).  The zone must publish DNSKEY and
+// CDS/CDNSKEY RRsets signed by its own keys while having no DS at its
+// parent, and every one of its name servers must publish identical
+// CDS/CDNSKEY RRsets under its signaling name, validated through the
+// chain of trust of the name server's own zone.
+func (resolver *Resolver) CheckBootstrap(zone string) *BootstrapResult {
+	zone = dns.Fqdn(zone)
+	result := &BootstrapResult{
+		Zone:    zone,
+		Signals: make([]BootstrapSignal, 0),
+	}
+
+	signedZone, err := queryDelegation(zone)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if !signedZone.checkHasDnskeys() {
+		result.Err = ErrDnskeyNotAvailable
+		return result
+	}
+	if !signedZone.Ds.IsEmpty() {
+		result.Err = ErrDsPresent
+		return result
+	}
+
+	// The apex RRsets can only be validated against the keys of the
+	// zone itself, as there is no DS to anchor them.
+	budget := newValidationBudget(resolver.Limits)
+	if err := signedZone.verifyRRSIG(signedZone.Dnskey, budget); err != nil {
+		result.Err = newValidationError(zone, StepDnskey, signedZone.Dnskey, ErrRrsigValidationError, err)
+		return result
+	}
+	apex := make(map[uint16]*RRSet)
+	for _, qtype := range []uint16{dns.TypeCDS, dns.TypeCDNSKEY} {
+		rrset, err := queryRRset(zone, qtype)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		if rrset.IsEmpty() {
+			continue
+		}
+		if err := signedZone.verifyRRSIG(rrset, budget); err != nil {
+			result.Err = newValidationError(zone, StepAnswer, rrset, ErrRrsigValidationError, err)
+			return result
+		}
+		apex[qtype] = rrset
+	}
+	if len(apex) == 0 {
+		result.Err = ErrCdsNotAvailable
+		return result
+	}
+
+	nameservers, err := queryRRset(zone, dns.TypeNS)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if nameservers.IsEmpty() {
+		result.Err = ErrNoNameservers
+		return result
+	}
+
+	valid := 0
+	for _, rr := range nameservers.RrSet {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		signal := resolver.checkSignal(zone, ns.Ns, apex)
+		if signal.Valid {
+			valid++
+		}
+		result.Signals = append(result.Signals, signal)
+	}
+	result.Bootstrappable = valid > 0 && valid == len(result.Signals)
+	if !result.Bootstrappable {
+		result.Err = ErrBootstrapIncomplete
+	}
+	return result
+}
+
+// checkSignal validates the signaling RRsets published for zone under
+// nameserver and compares them with the RRsets at the apex of zone.
+func (resolver *Resolver) checkSignal(zone string, nameserver string, apex map[uint16]*RRSet) BootstrapSignal {
+	signal := BootstrapSignal{
+		Nameserver: nameserver,
+		Name:       SignalName(zone, nameserver),
+	}
+	// Signals below the zone itself would be validated with the very
+	// keys that are being bootstrapped.
+	if dns.IsSubDomain(zone, nameserver) {
+		signal.Err = ErrSignalInBailiwick
+		return signal
+	}
+
+	for qtype, apexRRset := range apex {
+		rrSet, _, err := resolver.StrictNSQuery(signal.Name, qtype)
+		if errors.Is(err, ErrNoResult) {
+			signal.Err = ErrSignalNotAvailable
+			return signal
+		}
+		if err != nil {
+			signal.Err = err
+			return signal
+		}
+		if !sameRdata(rrSet, apexRRset.RrSet) {
+			signal.Err = ErrSignalMismatch
+			return signal
+		}
+	}
+	signal.Valid = true
+	return signal
+}
+
+// sameRdata returns true if both RR lists hold the same set of RDATA,
+// regardless of owner name and TTL.
+func sameRdata(a []dns.RR, b []dns.RR) bool {
+	set := make(map[string]bool, len(a))
+	for _, rr := range a {
+		set[rdataString(rr)] = true
+	}
+	other := make(map[string]bool, len(b))
+	for _, rr := range b {
+		if !set[rdataString(rr)] {
+			return false
+		}
+		other[rdataString(rr)] = true
+	}
+	return len(set) == len(other)
+}
+
+// rdataString returns the presentation format of the RDATA of rr.
+func rdataString(rr dns.RR) string {
+	return strings.ToUpper(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
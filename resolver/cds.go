@@ -0,0 +1,251 @@
+package resolver
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// CDSState is the state of the automated DS maintenance of a Zone
+// (RFC 7344, RFC 8078, RFC 9615).
+type CDSState string
+
+const (
+	CDSAbsent          CDSState = "absent"
+	CDSInSync          CDSState = "in sync"
+	CDSRolloverPending CDSState = "rollover pending"
+	CDSDeleteRequested CDSState = "delete requested"
+	CDSInconsistent    CDSState = "inconsistent CDS/CDNSKEY"
+	CDSBogus           CDSState = "bogus CDS/CDNSKEY signature"
+	CDSNotSignedByDS   CDSState = "CDS/CDNSKEY not signed by a DS key"
+)
+
+// CDSResult holds the CDS and CDNSKEY RRsets published by a Zone and
+// their state compared to the DNSKEY RRset of the Zone and the DS RRset
+// at its parent.
+type CDSResult struct {
+	Zone    string   `json:"zone"`
+	Cds     *RRSet   `json:"cds"`
+	Cdnskey *RRSet   `json:"cdnskey"`
+	State   CDSState `json:"state"`
+	Err     error    `json:"-"`
+}
+
+// CheckCDS fetches the CDS and CDNSKEY RRsets of the signed Zone, validates
+// their signatures against the keys of the Zone referenced by its DS
+// RRset at the parent, or any key of the Zone for the initial enrollment,
+// and compares them with each other and with the DS RRset.
+func (resolver *Resolver) CheckCDS(signedZone *SignedZone) *CDSResult {
+	result := &CDSResult{
+		Zone:  signedZone.Zone,
+		State: CDSAbsent,
+	}
+
+	var err error
+	result.Cds, err = queryRRset(signedZone.Zone, dns.TypeCDS)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Cdnskey, err = queryRRset(signedZone.Zone, dns.TypeCDNSKEY)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if result.Cds.IsEmpty() && result.Cdnskey.IsEmpty() {
+		return result
+	}
+
+	// Both RRsets must be signed by a key that the DS RRset references
+	// (RFC 7344, Section 4.1), so that whoever controls the current chain
+	// of trust requests the change.  Without DS, any key of the Zone
+	// signs the initial enrollment.
+	signers := signedZone
+	if parentDs := dsRecords(signedZone.Ds); len(parentDs) > 0 {
+		signers = dsReferencedZone(signedZone, parentDs)
+	}
+	budget := newValidationBudget(resolver.Limits)
+	for _, rrset := range []*RRSet{result.Cds, result.Cdnskey} {
+		if rrset.IsEmpty() {
+			continue
+		}
+		err := signers.verifyRRSIG(rrset, budget)
+		if err == nil {
+			continue
+		}
+		result.State = CDSBogus
+		result.Err = err
+		if signers != signedZone && signedZone.verifyRRSIG(rrset, budget) == nil {
+			result.State = CDSNotSignedByDS
+		}
+		return result
+	}
+
+	result.State = compareCDS(signedZone, result.Cds.RrSet, result.Cdnskey.RrSet)
+	return result
+}
+
+// compareCDS computes the CDSState of the validated CDS and CDNSKEY
+// records of the signed Zone.
+func compareCDS(signedZone *SignedZone, cdsRRs []dns.RR, cdnskeyRRs []dns.RR) CDSState {
+	cds := make([]*dns.DS, 0, len(cdsRRs))
+	for _, rr := range cdsRRs {
+		if t, ok := rr.(*dns.CDS); ok {
+			cds = append(cds, &t.DS)
+		}
+	}
+	cdnskeys := make([]*dns.DNSKEY, 0, len(cdnskeyRRs))
+	for _, rr := range cdnskeyRRs {
+		if t, ok := rr.(*dns.CDNSKEY); ok {
+			cdnskeys = append(cdnskeys, &t.DNSKEY)
+		}
+	}
+
+	// A single record with algorithm 0 requests the removal of the DS
+	// RRset (RFC 8078, Section 4).
+	cdsDelete := len(cds) == 1 && cds[0].Algorithm == 0
+	cdnskeyDelete := len(cdnskeys) == 1 && cdnskeys[0].Algorithm == 0
+	switch {
+	case cdsDelete && (cdnskeyDelete || len(cdnskeys) == 0),
+		cdnskeyDelete && len(cds) == 0:
+		return CDSDeleteRequested
+	case cdsDelete || cdnskeyDelete:
+		return CDSInconsistent
+	}
+
+	// When both are published, every CDS must be the digest of a
+	// CDNSKEY and every CDNSKEY must be referenced by a CDS
+	// (RFC 7344, Section 4).
+	if len(cds) > 0 && len(cdnskeys) > 0 {
+		for _, ds := range cds {
+			if !dsMatchesAnyKey(ds, cdnskeys) {
+				return CDSInconsistent
+			}
+		}
+		for _, key := range cdnskeys {
+			if !keyMatchesAnyDS(key, cds) {
+				return CDSInconsistent
+			}
+		}
+	}
+
+	// The proposed DS RRset must match at least one key of the Zone, or
+	// the Zone would no longer validate after the parent applies it.
+	zoneKeys := signedZone.Keys()
+	proposed := cds
+	if len(proposed) == 0 {
+		for _, key := range cdnskeys {
+			if ds := key.ToDS(dns.SHA256); ds != nil {
+				proposed = append(proposed, ds)
+			}
+		}
+	}
+	matchesZone := false
+	for _, ds := range proposed {
+		if dsMatchesAnyKey(ds, zoneKeys) {
+			matchesZone = true
+			break
+		}
+	}
+	if !matchesZone {
+		return CDSInconsistent
+	}
+
+	parentDs := dsRecords(signedZone.Ds)
+	if len(cds) > 0 && sameDSSet(cds, parentDs) {
+		return CDSInSync
+	}
+	if len(cds) == 0 && sameKeySet(cdnskeys, parentDs) {
+		return CDSInSync
+	}
+	return CDSRolloverPending
+}
+
+// dsRecords returns the DS records of the RRset.
+func dsRecords(rrset *RRSet) []*dns.DS {
+	dsSet := make([]*dns.DS, 0)
+	if rrset == nil {
+		return dsSet
+	}
+	for _, rr := range rrset.RrSet {
+		if ds, ok := rr.(*dns.DS); ok {
+			dsSet = append(dsSet, ds)
+		}
+	}
+	return dsSet
+}
+
+// dsReferencedZone returns a copy of the signed Zone holding only the
+// DNSKEYs that one of the DS records is a digest of.
+func dsReferencedZone(signedZone *SignedZone, dsSet []*dns.DS) *SignedZone {
+	referenced := NewSignedZone(signedZone.Zone)
+	referenced.Ds = signedZone.Ds
+	referenced.PubKeyLookup = make(map[uint16][]*dns.DNSKEY)
+	for _, key := range signedZone.Keys() {
+		if keyMatchesAnyDS(key, dsSet) {
+			referenced.Dnskey.RrSet = append(referenced.Dnskey.RrSet, key)
+			referenced.addPubKey(key)
+		}
+	}
+	return referenced
+}
+
+// dsKey returns a canonical representation of a DS record.
+func dsKey(ds *dns.DS) string {
+	return fmt.Sprintf("%v %v %v %v", ds.KeyTag, ds.Algorithm, ds.DigestType, strings.ToUpper(ds.Digest))
+}
+
+// dsMatchesAnyKey returns true if the DS is the digest of one of the keys.
+func dsMatchesAnyKey(ds *dns.DS, keys []*dns.DNSKEY) bool {
+	for _, key := range keys {
+		if key.Algorithm != ds.Algorithm || key.KeyTag() != ds.KeyTag {
+			continue
+		}
+		if digest := key.ToDS(ds.DigestType); digest != nil && strings.EqualFold(digest.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyMatchesAnyDS returns true if one of the DS records is a digest of key.
+func keyMatchesAnyDS(key *dns.DNSKEY, dsSet []*dns.DS) bool {
+	for _, ds := range dsSet {
+		if dsMatchesAnyKey(ds, []*dns.DNSKEY{key}) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameDSSet returns true if both sets hold the same DS records.
+func sameDSSet(a []*dns.DS, b []*dns.DS) bool {
+	set := make(map[string]bool, len(a))
+	for _, ds := range a {
+		set[dsKey(ds)] = true
+	}
+	other := make(map[string]bool, len(b))
+	for _, ds := range b {
+		if !set[dsKey(ds)] {
+			return false
+		}
+		other[dsKey(ds)] = true
+	}
+	return len(set) == len(other)
+}
+
+// sameKeySet returns true if every DS record is the digest of one of the
+// keys and every key is referenced by one of the DS records.
+func sameKeySet(keys []*dns.DNSKEY, dsSet []*dns.DS) bool {
+	for _, ds := range dsSet {
+		if !dsMatchesAnyKey(ds, keys) {
+			return false
+		}
+	}
+	for _, key := range keys {
+		if !keyMatchesAnyDS(key, dsSet) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,225 @@
+package resolver
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// TLSA certificate usages (RFC 6698, RFC 7218)
+const (
+	TLSAUsagePkixTA = 0
+	TLSAUsagePkixEE = 1
+	TLSAUsageDaneTA = 2
+	TLSAUsageDaneEE = 3
+)
+
+// Errors returned when matching TLSA records against certificates.
+var (
+	ErrNoCertificates  = errors.New("no certificate found")
+	ErrTLSAUnsupported = errors.New("unsupported TLSA parameters")
+	ErrTLSANoMatch     = errors.New("TLSA record does not match the certificate chain")
+	ErrTLSAPkixInvalid = errors.New("certificate chain does not validate with PKIX")
+	ErrTLSANotAnchored = errors.New("leaf certificate does not chain to the trust anchor matched by the TLSA record")
+)
+
+var (
+	tlsaUsageNames      = map[uint8]string{0: "PKIX-TA", 1: "PKIX-EE", 2: "DANE-TA", 3: "DANE-EE"}
+	tlsaSelectorNames   = map[uint8]string{0: "Cert", 1: "SPKI"}
+	tlsaMatchingNames   = map[uint8]string{0: "Full", 1: "SHA2-256", 2: "SHA2-512"}
+	tlsaTrustAnchorUses = map[uint8]bool{TLSAUsagePkixTA: true, TLSAUsageDaneTA: true}
+)
+
+// TLSAResult is the outcome of matching a single TLSA record against a
+// certificate chain.
+type TLSAResult struct {
+	Record       *dns.TLSA `json:"record"`
+	Usage        string    `json:"usage"`
+	Selector     string    `json:"selector"`
+	MatchingType string    `json:"matchingType"`
+	// Certificate is the index in the chain of the certificate matched
+	// by the record, or -1 if none matched.
+	Certificate int   `json:"certificate"`
+	Valid       bool  `json:"valid"`
+	Err         error `json:"-"`
+}
+
+// TLSAName returns the owner name of the TLSA records of a service
+// (RFC 6698, Section 3), e.g. _443._tcp.example.com.
+func TLSAName(host string, port uint16, proto string) string {
+	return fmt.Sprintf("_%d._%s.%s", port, strings.ToLower(proto), dns.Fqdn(host))
+}
+
+// LookupTLSA fetches the Secure TLSA records of the service at host, port
+// and proto, as lookupSecure does.
+func (resolver *Resolver) LookupTLSA(host string, port uint16, proto string) ([]*dns.TLSA, *AuthenticationChain, error) {
+	rrSet, chain, err := resolver.lookupSecure(TLSAName(host, port, proto), dns.TypeTLSA)
+	if err != nil {
+		return nil, chain, err
+	}
+	records := make([]*dns.TLSA, 0, len(rrSet))
+	for _, rr := range rrSet {
+		if tlsa, ok := rr.(*dns.TLSA); ok {
+			records = append(records, tlsa)
+		}
+	}
+	return records, chain, nil
+}
+
+// MatchTLSA matches every TLSA record against the certificate chain, which
+// is ordered leaf first as presented by a TLS server.  End entity usages
+// only match the leaf, trust anchor usages any other certificate of the
+// chain that the leaf chains to (RFC 7671, Section 5.2): for DANE-TA, the
+// leaf must verify with the matched certificate as the only root, for
+// PKIX-TA the matched certificate must be on a path validated against the
+// system roots.  The PKIX usages additionally require the chain to
+// validate against the system roots for serverName.
+func MatchTLSA(records []*dns.TLSA, certs []*x509.Certificate, serverName string) []TLSAResult {
+	pkixChains, pkixErr := verifyPKIX(certs, serverName)
+
+	results := make([]TLSAResult, 0, len(records))
+	for _, record := range records {
+		result := TLSAResult{
+			Record:       record,
+			Usage:        parameterName(tlsaUsageNames, record.Usage),
+			Selector:     parameterName(tlsaSelectorNames, record.Selector),
+			MatchingType: parameterName(tlsaMatchingNames, record.MatchingType),
+			Certificate:  -1,
+		}
+		if _, ok := tlsaUsageNames[record.Usage]; !ok {
+			result.Err = ErrTLSAUnsupported
+			results = append(results, result)
+			continue
+		}
+
+		// The leaf is certs[0], trust anchors are searched in the rest
+		candidates := certs
+		offset := 0
+		if tlsaTrustAnchorUses[record.Usage] {
+			candidates = nil
+			if len(certs) > 1 {
+				candidates = certs[1:]
+				offset = 1
+			}
+		} else if len(certs) > 0 {
+			candidates = certs[:1]
+		}
+
+		result.Err = ErrTLSANoMatch
+		for i, cert := range candidates {
+			digest, err := dns.CertificateToDANE(record.Selector, record.MatchingType, cert)
+			if err != nil {
+				result.Err = ErrTLSAUnsupported
+				break
+			}
+			if !strings.EqualFold(digest, record.Certificate) {
+				continue
+			}
+			switch record.Usage {
+			case TLSAUsageDaneTA:
+				if err := verifyDANETA(certs, cert, serverName); err != nil {
+					result.Err = fmt.Errorf("%w: %v", ErrTLSANotAnchored, err)
+					continue
+				}
+			case TLSAUsagePkixTA:
+				if pkixErr == nil && !onChain(pkixChains, cert) {
+					result.Err = ErrTLSANotAnchored
+					continue
+				}
+			}
+			result.Certificate = i + offset
+			result.Err = nil
+			break
+		}
+
+		if result.Err == nil && (record.Usage == TLSAUsagePkixTA || record.Usage == TLSAUsagePkixEE) && pkixErr != nil {
+			result.Err = fmt.Errorf("%w: %v", ErrTLSAPkixInvalid, pkixErr)
+		}
+		result.Valid = result.Err == nil
+		results = append(results, result)
+	}
+	return results
+}
+
+// verifyPKIX validates the certificate chain against the system roots and
+// returns the verified paths.
+func verifyPKIX(certs []*x509.Certificate, serverName string) ([][]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, ErrNoCertificates
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	return certs[0].Verify(x509.VerifyOptions{
+		DNSName:       strings.TrimSuffix(serverName, "."),
+		Intermediates: intermediates,
+	})
+}
+
+// verifyDANETA validates the leaf of the certificate chain with the
+// trust anchor as the only root, the other certificates of the chain as
+// intermediates.
+func verifyDANETA(certs []*x509.Certificate, anchor *x509.Certificate, serverName string) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(anchor)
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		if !cert.Equal(anchor) {
+			intermediates.AddCert(cert)
+		}
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       strings.TrimSuffix(serverName, "."),
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+// onChain returns true if cert is part of one of the chains.
+func onChain(chains [][]*x509.Certificate, cert *x509.Certificate) bool {
+	for _, chain := range chains {
+		for _, c := range chain {
+			if c.Equal(cert) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseCertificates parses a certificate chain from PEM data, or from a
+// single DER encoded certificate if data contains no PEM block.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0)
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, ErrNoCertificates
+	}
+	return []*x509.Certificate{cert}, nil
+}
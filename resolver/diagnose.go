@@ -0,0 +1,140 @@
+package resolver
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+)
+
+// Misconfiguration classifies a common DNSSEC deployment mistake.
+type Misconfiguration string
+
+const (
+	MisconfigOrphanDS          Misconfiguration = "orphan DS"
+	MisconfigStaleDS           Misconfiguration = "stale DS"
+	MisconfigAlgorithmMismatch Misconfiguration = "DS/DNSKEY algorithm mismatch"
+	MisconfigZSKOnly           Misconfiguration = "ZSK-only zone"
+	MisconfigMissingSEP        Misconfiguration = "missing SEP flag"
+	MisconfigRevokedKSK        Misconfiguration = "revoked KSK in use"
+)
+
+// Diagnosis is a Misconfiguration found in a Zone of the chain.
+type Diagnosis struct {
+	Zone   string           `json:"zone"`
+	Class  Misconfiguration `json:"class"`
+	Detail string           `json:"detail"`
+}
+
+func (d Diagnosis) String() string {
+	return fmt.Sprintf("%v:%v", d.Zone, d.Class)
+}
+
+// Diagnose inspects every Zone of the DelegationChain for common
+// misconfigurations of the DS and DNSKEY RRsets.  Unlike Verify, it does
+// not stop at the first failure and it does not check signatures.
+func (authChain *AuthenticationChain) Diagnose() []Diagnosis {
+	diagnoses := make([]Diagnosis, 0)
+	for _, signedZone := range authChain.DelegationChain {
+		diagnoses = append(diagnoses, signedZone.diagnose()...)
+	}
+	return diagnoses
+}
+
+// diagnose classifies the misconfigurations of a single Zone.
+func (z SignedZone) diagnose() []Diagnosis {
+	diagnoses := make([]Diagnosis, 0)
+	add := func(class Misconfiguration, format string, args ...interface{}) {
+		diagnoses = append(diagnoses, Diagnosis{
+			Zone:   z.Zone,
+			Class:  class,
+			Detail: fmt.Sprintf(format, args...),
+		})
+	}
+
+	keys := make([]*dns.DNSKEY, 0, len(z.Dnskey.RrSet))
+	keyAlgorithms := make(map[uint8]bool)
+	sep := 0
+	for _, rr := range z.Dnskey.RrSet {
+		if key, ok := rr.(*dns.DNSKEY); ok {
+			keys = append(keys, key)
+			keyAlgorithms[key.Algorithm] = true
+			if key.Flags&dns.SEP != 0 {
+				sep++
+			}
+		}
+	}
+	dsSet := make([]*dns.DS, 0, len(z.Ds.RrSet))
+	for _, rr := range z.Ds.RrSet {
+		if ds, ok := rr.(*dns.DS); ok {
+			dsSet = append(dsSet, ds)
+		}
+	}
+
+	if len(keys) == 0 {
+		if len(dsSet) > 0 {
+			add(MisconfigOrphanDS, "the parent publishes %v DS records but the zone has no DNSKEY", len(dsSet))
+		}
+		return diagnoses
+	}
+	if sep == 0 {
+		add(MisconfigZSKOnly, "none of the %v DNSKEYs has the SEP flag set", len(keys))
+	}
+
+	// A revoked key must no longer sign the DNSKEY RRset (RFC 5011)
+	if z.Dnskey.IsSigned() {
+		for _, key := range z.lookupPubKey(z.Dnskey.RrSig.KeyTag, z.Dnskey.RrSig.Algorithm) {
+			if key.Flags&dns.REVOKE != 0 {
+				add(MisconfigRevokedKSK, "the DNSKEY RRset is signed by revoked key %v", key.KeyTag())
+			}
+		}
+	}
+
+	if len(dsSet) == 0 {
+		return diagnoses
+	}
+
+	algorithmMatch := false
+	for _, ds := range dsSet {
+		if keyAlgorithms[ds.Algorithm] {
+			algorithmMatch = true
+		}
+	}
+	if !algorithmMatch {
+		add(MisconfigAlgorithmMismatch, "no DS algorithm matches the algorithm of a DNSKEY")
+		return diagnoses
+	}
+
+	matched := 0
+	for _, ds := range dsSet {
+		for _, key := range z.lookupPubKey(ds.KeyTag, ds.Algorithm) {
+			if !dsMatchesAnyKey(ds, []*dns.DNSKEY{key}) {
+				continue
+			}
+			matched++
+			// Without any SEP key, the zone is reported as ZSK-only
+			if key.Flags&dns.SEP == 0 && sep > 0 {
+				add(MisconfigMissingSEP, "DS %v references key %v without the SEP flag", ds.KeyTag, key.KeyTag())
+			}
+			if key.Flags&dns.REVOKE != 0 {
+				add(MisconfigRevokedKSK, "DS %v references revoked key %v", ds.KeyTag, key.KeyTag())
+			}
+		}
+	}
+	if matched == 0 {
+		add(MisconfigStaleDS, "none of the %v DS records matches a published DNSKEY", len(dsSet))
+	}
+	return diagnoses
+}
+
+// DiagnoseName populates the AuthenticationChain of every ancestor of
+// qname, including qname itself, and diagnoses it.  It is meant for
+// names whose answer is not signed, where StrictNSQuery returns no chain,
+// e.g. to find a DS at the parent of a zone without DNSKEY.  It queries
+// the DNSKEY and DS RRsets of every ancestor, so callers that already
+// have a chain covering qname should diagnose that chain instead.
+func (resolver *Resolver) DiagnoseName(qname string) ([]Diagnosis, error) {
+	authChain := resolver.newAuthenticationChain()
+	if err := authChain.Populate(dns.Fqdn(qname)); err != nil {
+		return nil, err
+	}
+	return authChain.Diagnose(), nil
+}
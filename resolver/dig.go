@@ -0,0 +1,151 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DigOptions are the dig-style options of a Dig query.
+type DigOptions struct {
+	// Server is the address of the name server, with an optional port.
+	// The first upstream resolver is used if it is empty.
+	Server           string
+	TCP              bool
+	CheckingDisabled bool
+	Recursion        bool
+}
+
+// DigSection names a section of a DNS message.
+type DigSection string
+
+const (
+	SectionAnswer    DigSection = "ANSWER"
+	SectionAuthority DigSection = "AUTHORITY"
+)
+
+// RRsetValidation is the validation result of an RRset of a response.
+type RRsetValidation struct {
+	Section DigSection
+	RRset   *RRSet
+	Status  SecurityStatus
+	Err     error
+}
+
+// DigResult is the response to a Dig query along with the validation
+// result of each RRset of its answer and authority sections.
+type DigResult struct {
+	Msg         *dns.Msg
+	Server      string
+	RTT         time.Duration
+	Validations []RRsetValidation
+}
+
+// Dig sends a single query for qname to a name server, like dig +dnssec,
+// and validates every RRset of the answer and authority sections against
+// its chain of trust.  The chains are built through the upstream
+// resolvers, whatever server answered the query.  A truncated UDP
+// response is retried over TCP.
+func (resolver *Resolver) Dig(qname string, qtype uint16, opts DigOptions) (*DigResult, error) {
+	server := opts.Server
+	if server == "" {
+		server = CloudflareDNS
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, strconv.Itoa(DNSPort))
+	}
+
+	dnsMessage := NewDNSMessage()
+	dnsMessage.SetQuestion(dns.Fqdn(qname), qtype)
+	dnsMessage.RecursionDesired = opts.Recursion
+	dnsMessage.CheckingDisabled = opts.CheckingDisabled
+
+	client := &dns.Client{ReadTimeout: DefaultTimeout}
+	if opts.TCP {
+		client.Net = "tcp"
+	}
+	r, rtt, err := resolver.exchange(client, dnsMessage, server)
+	if err == nil && r.Truncated && !opts.TCP {
+		client.Net = "tcp"
+		r, rtt, err = resolver.exchange(client, dnsMessage, server)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DigResult{
+		Msg:         r,
+		Server:      server,
+		RTT:         rtt,
+		Validations: make([]RRsetValidation, 0),
+	}
+	chains := make(map[string]*AuthenticationChain)
+	for _, section := range []struct {
+		name DigSection
+		rrs  []dns.RR
+	}{
+		{SectionAnswer, r.Answer},
+		{SectionAuthority, r.Ns},
+	} {
+		for _, validation := range groupRRsets(section.name, section.rrs) {
+			validation.Err = resolver.validateRRset(validation.RRset, chains)
+			validation.Status = StatusOf(validation.Err)
+			result.Validations = append(result.Validations, validation)
+		}
+	}
+	return result, nil
+}
+
+// validateRRset validates an RRset against the chain of its signer,
+// reusing the chains already built.
+func (resolver *Resolver) validateRRset(rrset *RRSet, chains map[string]*AuthenticationChain) error {
+	if !rrset.IsSigned() {
+		return ErrResourceNotSigned
+	}
+	signerName := rrset.SignerName()
+	authChain, ok := chains[signerName]
+	if !ok {
+		var err error
+		authChain, err = resolver.populateChain(signerName)
+		if err != nil {
+			return err
+		}
+		chains[signerName] = authChain
+	}
+	return authChain.Verify(rrset)
+}
+
+// groupRRsets groups the records of a message section into RRsets by
+// owner name, class and type, in order of first appearance, each with the
+// RRSIGs covering it.
+func groupRRsets(section DigSection, rrs []dns.RR) []RRsetValidation {
+	type rrsetKey struct {
+		name  string
+		class uint16
+		rtype uint16
+	}
+	validations := make([]RRsetValidation, 0)
+	index := make(map[rrsetKey]int)
+	lookup := func(key rrsetKey) *RRsetValidation {
+		i, ok := index[key]
+		if !ok {
+			i = len(validations)
+			index[key] = i
+			validations = append(validations, RRsetValidation{Section: section, RRset: NewSignedRRSet()})
+		}
+		return &validations[i]
+	}
+
+	for _, rr := range rrs {
+		h := rr.Header()
+		if rrsig, ok := rr.(*dns.RRSIG); ok {
+			validation := lookup(rrsetKey{dns.CanonicalName(h.Name), h.Class, rrsig.TypeCovered})
+			validation.RRset.addRRSIG(rrsig)
+			continue
+		}
+		validation := lookup(rrsetKey{dns.CanonicalName(h.Name), h.Class, h.Rrtype})
+		validation.RRset.RrSet = append(validation.RRset.RrSet, rr)
+	}
+	return validations
+}
@@ -0,0 +1,164 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// ExtendedErrorCodeUnsupportedNSEC3Iterations is the Extended DNS Error
+// for NSEC3 iteration counts above the limit of the validator (RFC 9276,
+// Section 3.2), which github.com/miekg/dns does not define.
+const ExtendedErrorCodeUnsupportedNSEC3Iterations uint16 = 27
+
+// ExtendedError is an RFC 8914 Extended DNS Error.
+type ExtendedError struct {
+	InfoCode  uint16 `json:"infoCode"`
+	ExtraText string `json:"extraText,omitempty"`
+}
+
+func (e ExtendedError) String() string {
+	s := ExtendedErrorString(e.InfoCode)
+	if e.ExtraText != "" {
+		s = fmt.Sprintf("%v: %v", s, e.ExtraText)
+	}
+	return s
+}
+
+// UpstreamResponse summarises the response of one upstream resolver.
+type UpstreamResponse struct {
+	Server            string          `json:"server"`
+	Rcode             int             `json:"rcode"`
+	AuthenticatedData bool            `json:"ad"`
+	ExtendedErrors    []ExtendedError `json:"extendedErrors,omitempty"`
+	// AnswersWithCD is set if the upstream answered the query that it
+	// failed with SERVFAIL once asked again with checking disabled.
+	AnswersWithCD bool `json:"answersWithCD,omitempty"`
+}
+
+// Bogus returns true if the upstream judged the data to be bogus: it
+// refused to answer with SERVFAIL, which is how validating resolvers
+// report bogus data when queried with checking enabled, and either gave
+// a DNSSEC Extended DNS Error or answered once checking was disabled.
+// A SERVFAIL for any other reason, such as unreachable name servers,
+// is not a verdict.
+func (u UpstreamResponse) Bogus() bool {
+	if u.Rcode != dns.RcodeServerFailure {
+		return false
+	}
+	return u.dnssecFailure() || u.AnswersWithCD
+}
+
+// dnssecFailure returns true if the upstream gave one of the Extended DNS
+// Errors reporting a DNSSEC validation failure, DNSSEC Bogus (6) to NSEC
+// Missing (12).
+func (u UpstreamResponse) dnssecFailure() bool {
+	for _, e := range u.ExtendedErrors {
+		if e.InfoCode >= dns.ExtendedErrorCodeDNSBogus && e.InfoCode <= dns.ExtendedErrorCodeNSECMissing {
+			return true
+		}
+	}
+	return false
+}
+
+func (u UpstreamResponse) String() string {
+	s := fmt.Sprintf("%v:%v", u.Server, dns.RcodeToString[u.Rcode])
+	for _, e := range u.ExtendedErrors {
+		s = fmt.Sprintf("%v:%v", s, e)
+	}
+	return s
+}
+
+// UpstreamError is returned when none of the upstream resolvers gave a
+// usable answer.  It keeps the RCODE and Extended DNS Errors returned by
+// every upstream, the errors of those that could not be reached, and wraps
+// ErrNsNotAvailable.
+type UpstreamError struct {
+	Responses []UpstreamResponse
+	Failures  []error
+}
+
+func (e *UpstreamError) Error() string {
+	responses := make([]string, 0, len(e.Responses)+len(e.Failures))
+	for _, r := range e.Responses {
+		responses = append(responses, r.String())
+	}
+	for _, f := range e.Failures {
+		responses = append(responses, f.Error())
+	}
+	return fmt.Sprintf("%v: %v", ErrNsNotAvailable, strings.Join(responses, ", "))
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return ErrNsNotAvailable
+}
+
+// newUpstreamResponse extracts the RCODE, the AD bit and the EDE options
+// of msg.
+func newUpstreamResponse(server string, msg *dns.Msg) UpstreamResponse {
+	response := UpstreamResponse{
+		Server:            server,
+		Rcode:             msg.Rcode,
+		AuthenticatedData: msg.AuthenticatedData,
+	}
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return response
+	}
+	for _, o := range opt.Option {
+		if ede, ok := o.(*dns.EDNS0_EDE); ok {
+			response.ExtendedErrors = append(response.ExtendedErrors, ExtendedError{
+				InfoCode:  ede.InfoCode,
+				ExtraText: ede.ExtraText,
+			})
+		}
+	}
+	return response
+}
+
+// ExtendedErrorFor maps a validation outcome to the RFC 8914 Extended DNS
+// Error describing it.  It returns false when the outcome is not an error
+// that has a matching code, such as a secure or an unsigned answer.
+func ExtendedErrorFor(err error) (uint16, bool) {
+	switch {
+	case err == nil:
+		return 0, false
+	case errors.Is(err, ErrValidationBudgetExceeded):
+		return dns.ExtendedErrorCodeDNSSECIndeterminate, true
+	case errors.Is(err, ErrNSEC3IterationsExceeded):
+		return ExtendedErrorCodeUnsupportedNSEC3Iterations, true
+	case errors.Is(err, ErrRrsigNotYetValid):
+		return dns.ExtendedErrorCodeSignatureNotYetValid, true
+	case errors.Is(err, ErrRrsigValidityPeriod):
+		return dns.ExtendedErrorCodeSignatureExpired, true
+	case errors.Is(err, dns.ErrAlg):
+		return dns.ExtendedErrorCodeUnsupportedDNSKEYAlgorithm, true
+	case errors.Is(err, ErrUnknownDsDigestType):
+		return dns.ExtendedErrorCodeUnsupportedDSDigestType, true
+	case errors.Is(err, ErrDnskeyNotAvailable):
+		return dns.ExtendedErrorCodeDNSKEYMissing, true
+	case errors.Is(err, ErrRRSigNotAvailable):
+		return dns.ExtendedErrorCodeRRSIGsMissing, true
+	case errors.Is(err, ErrInvalidRRsig),
+		errors.Is(err, ErrRrsigValidationError),
+		errors.Is(err, ErrDsInvalid),
+		errors.Is(err, ErrDelegationChain):
+		return dns.ExtendedErrorCodeDNSBogus, true
+	case errors.Is(err, ErrNsNotAvailable):
+		return dns.ExtendedErrorCodeNoReachableAuthority, true
+	}
+	return 0, false
+}
+
+// ExtendedErrorString formats an Extended DNS Error code along with its
+// description, e.g. "6 (DNSSEC Bogus)".
+func ExtendedErrorString(infoCode uint16) string {
+	if s, ok := dns.ExtendedErrorCodeToString[infoCode]; ok {
+		return fmt.Sprintf("%v (%v)", infoCode, s)
+	}
+	if infoCode == ExtendedErrorCodeUnsupportedNSEC3Iterations {
+		return fmt.Sprintf("%v (Unsupported NSEC3 Iterations Value)", infoCode)
+	}
+	return fmt.Sprintf("%v", infoCode)
+}
@@ -0,0 +1,265 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Explanation describes the outcome of a validation in plain words for
+// people who do not know the DNSSEC internals.
+type Explanation struct {
+	Status SecurityStatus `json:"status"`
+	// Narrative explains what failed and its likely cause.
+	Narrative []string `json:"narrative"`
+	// Remediation lists the steps that usually fix the failure.
+	Remediation []string `json:"remediation"`
+}
+
+// misconfigurationRemediation is the usual fix for each Misconfiguration.
+var misconfigurationRemediation = map[Misconfiguration]string{
+	MisconfigOrphanDS:          "Remove the DS records at the registrar, or publish the DNSKEYs again if the zone should stay signed.",
+	MisconfigStaleDS:           "Replace the DS records at the registrar with the DS of the current KSK.",
+	MisconfigAlgorithmMismatch: "Publish a DS for the new algorithm at the registrar to complete the algorithm rollover.",
+	MisconfigZSKOnly:           "Set the SEP flag (257) on the key the DS refers to.",
+	MisconfigMissingSEP:        "Set the SEP flag (257) on the key the DS refers to.",
+	MisconfigRevokedKSK:        "Sign the DNSKEY RRset with a key that is not revoked and point the DS to it.",
+}
+
+// Explain turns the result of QueryChain into an Explanation.  answer and
+// authChain may be nil.  The misconfigurations found by Diagnose are
+// added as likely causes.
+func Explain(answer *RRSet, authChain *AuthenticationChain, err error) Explanation {
+	e := Explanation{
+		Status:      StatusOf(err),
+		Narrative:   make([]string, 0),
+		Remediation: make([]string, 0),
+	}
+	say := func(format string, args ...interface{}) {
+		e.Narrative = append(e.Narrative, fmt.Sprintf(format, args...))
+	}
+	fix := func(format string, args ...interface{}) {
+		e.Remediation = append(e.Remediation, fmt.Sprintf(format, args...))
+	}
+
+	var validationErr *ValidationError
+	switch {
+	case err == nil:
+		say("The answer validated: every signature and delegation from the root zone down to it is correct.")
+	case errors.As(err, &validationErr):
+		explainValidationError(validationErr, answer, authChain, say, fix)
+	case errors.Is(err, ErrResourceNotSigned):
+		say("The answer is not signed, so it is not protected by DNSSEC.")
+		fix("Sign the zone and publish its DS at the parent if the name should be protected.")
+	case errors.Is(err, ErrNSEC3IterationsExceeded):
+		say("The negative answer uses more NSEC3 iterations than allowed, so it is treated as insecure rather than " +
+			"spending the hashing work to check it (RFC 9276, CVE-2023-50868).")
+		fix("Use NSEC3 with 0 additional iterations and no salt (RFC 9276).")
+	case errors.Is(err, ErrValidationBudgetExceeded):
+		say("The validation was aborted because it needed more work than allowed: too many keys sharing a key tag, " +
+			"too many signatures or too many zones. Resolvers treat such zones as failing to protect themselves " +
+			"against denial of service (CVE-2023-50387).")
+		fix("Keep the number of keys and signatures small.")
+	case errors.Is(err, ErrNoResult):
+		say("The name or record type does not exist, or an RRset needed for the validation could not be found.")
+		fix("Check that the name is spelled correctly and that the record exists.")
+	default:
+		say("No answer could be obtained from the upstream resolvers: %v.", err)
+		fix("Check that the authoritative name servers of the zone are reachable and answer for it.")
+	}
+
+	if authChain != nil && err != nil {
+		for _, d := range authChain.Diagnose() {
+			say("Also found in %v: %v, %v.", zoneName(d.Zone), d.Class, d.Detail)
+			if remediation, ok := misconfigurationRemediation[d.Class]; ok && !contains(e.Remediation, remediation) {
+				e.Remediation = append(e.Remediation, remediation)
+			}
+		}
+	}
+	return e
+}
+
+// explainValidationError explains the failed step of Verify.
+func explainValidationError(ve *ValidationError, answer *RRSet, authChain *AuthenticationChain,
+	say func(string, ...interface{}), fix func(string, ...interface{})) {
+
+	zone := SignedZone{Zone: ve.Zone, Dnskey: NewSignedRRSet(), Ds: NewSignedRRSet()}
+	parent := "its parent zone"
+	if authChain != nil {
+		for _, sz := range authChain.DelegationChain {
+			if sz.Zone == ve.Zone {
+				zone = sz
+				if sz.ParentZone != nil {
+					parent = zoneName(sz.ParentZone.Zone)
+				}
+				break
+			}
+		}
+	}
+	rrset := answer
+	switch ve.Step {
+	case StepDnskey:
+		rrset = zone.Dnskey
+	case StepDs, StepDelegation:
+		rrset = zone.Ds
+	}
+	rrtype := dns.TypeToString[ve.RRType]
+	name := zoneName(ve.Zone)
+	signer := fmt.Sprintf("key %v algorithm %v", ve.KeyTag, algorithmName(ve.Algorithm))
+
+	switch {
+	case errors.Is(ve.Err, ErrDsNotAvailable):
+		say("%v is signed, but %v publishes no DS record for it, so resolvers cannot link it to the chain of trust "+
+			"and treat it as unsigned.", name, parent)
+		fix("Submit the DS of the KSK of %v to the registrar, or publish CDS/CDNSKEY records for automated "+
+			"bootstrapping (RFC 9615, see measure --bootstrap).", name)
+
+	case errors.Is(ve.Err, ErrUnknownDsDigestType):
+		say("The DS records for %v in %v only use digest types this validator does not support; only SHA-1, "+
+			"SHA-256 and SHA-384 are checked. Resolvers treat the zone as unsigned.", name, parent)
+		fix("Publish a DS with digest type 2 (SHA-256) for %v.", name)
+
+	case ve.Step == StepDnskey && errors.Is(ve.Err, ErrDnskeyNotAvailable) && rrset.IsEmpty():
+		say("%v publishes no DNSKEY records although %v has DS records for it, typically because signing was turned "+
+			"off before the DS was removed.", name, parent)
+		fix("Remove the DS records at the registrar, or sign the zone again with the keys the DS refers to.")
+
+	case ve.Step == StepDelegation:
+		explainDelegation(ve, zone, parent, say, fix)
+
+	case errors.Is(ve.Cause, ErrDnskeyNotAvailable) || errors.Is(ve.Err, ErrDnskeyNotAvailable):
+		owner := ve.Zone
+		if ve.Step == StepDs && zone.ParentZone != nil {
+			owner = zone.ParentZone.Zone
+		}
+		say("The %v records of %v are signed by %v, but %v only publishes %v. This usually means the zone was "+
+			"re-signed with a key that is not published, or a key was removed while signatures made with it are "+
+			"still cached.", rrtype, name, signer, zoneName(owner), keyList(authChain, owner))
+		fix("Publish the key %v in the DNSKEY RRset of %v, or re-sign the %v records with a published key.", ve.KeyTag, zoneName(owner), rrtype)
+
+	case errors.Is(ve.Cause, ErrRrsigNotYetValid):
+		say("The signature by %v over the %v records of %v is not valid yet: it starts on %v.", signer, rrtype,
+			name, signatureTime(rrset, true))
+		fix("Check the clocks of the signer and of the validating resolvers (NTP); signatures should start in the past.")
+
+	case errors.Is(ve.Cause, ErrRrsigValidityPeriod):
+		say("The signature by %v over the %v records of %v expired on %v.", signer, rrtype, name,
+			signatureTime(rrset, false))
+		fix("Re-sign the zone and check that automatic re-signing of %v runs.", name)
+
+	case errors.Is(ve.Err, ErrValidationBudgetExceeded):
+		say("The validation of the %v records of %v was aborted because it needed more work than allowed, e.g. "+
+			"because many keys share the key tag %v.", rrtype, name, ve.KeyTag)
+		fix("Keep the number of keys sharing a key tag and the number of signatures small.")
+
+	default:
+		say("The signature by %v over the %v records of %v does not match the data. Either the records were "+
+			"changed after signing, or one of the name servers serves data signed with a different key.", signer,
+			rrtype, name)
+		fix("Re-sign %v and compare the answers of its name servers (measure --ns-consistency).", name)
+	}
+}
+
+// explainDelegation explains a DS record that matches no DNSKEY.
+func explainDelegation(ve *ValidationError, zone SignedZone, parent string,
+	say func(string, ...interface{}), fix func(string, ...interface{})) {
+
+	name := zoneName(ve.Zone)
+	keys := zone.Keys()
+	if len(keys) == 0 {
+		say("%v has DS records for %v, but %v publishes no DNSKEY.", parent, name, name)
+		fix("Remove the DS records at the registrar, or publish the DNSKEYs again.")
+		return
+	}
+
+	published := make([]string, 0, len(keys))
+	algorithmPublished := false
+	for _, key := range keys {
+		published = append(published, fmt.Sprintf("%v algorithm %v", key.KeyTag(), algorithmName(key.Algorithm)))
+		if key.Algorithm == ve.Algorithm {
+			algorithmPublished = true
+		}
+	}
+	sort.Strings(published)
+
+	ds := fmt.Sprintf("The DS for %v in %v refers to key %v algorithm %v, but %v only publishes keys %v", name,
+		parent, ve.KeyTag, algorithmName(ve.Algorithm), name, strings.Join(published, ", "))
+	switch {
+	case !algorithmPublished:
+		say("%v. This is likely an algorithm rollover where the DS was not updated.", ds)
+		fix("Replace the DS at the registrar with the DS of the new KSK of %v.", name)
+	case len(zone.lookupPubKey(ve.KeyTag, ve.Algorithm)) == 0:
+		say("%v. This is likely a key rollover where the DS was not updated, or the old KSK was removed too early.", ds)
+		fix("Replace the DS at the registrar with the DS of the current KSK of %v, or publish the old KSK again until the new DS is in place.", name)
+	default:
+		say("The DS for %v in %v refers to key %v algorithm %v, which %v publishes, but the digest does not match "+
+			"it. The DS was probably computed from a different key or copied incorrectly.", name, parent,
+			ve.KeyTag, algorithmName(ve.Algorithm), name)
+		fix("Generate the DS again from the published KSK of %v and update it at the registrar.", name)
+	}
+}
+
+// keyList describes the DNSKEYs published by zone, as far as the chain
+// knows them.
+func keyList(authChain *AuthenticationChain, zone string) string {
+	if authChain != nil {
+		for _, sz := range authChain.DelegationChain {
+			if sz.Zone != zone {
+				continue
+			}
+			keys := sz.Keys()
+			if len(keys) == 0 {
+				return "no keys"
+			}
+			described := make([]string, 0, len(keys))
+			for _, key := range keys {
+				described = append(described, fmt.Sprintf("%v algorithm %v", key.KeyTag(), algorithmName(key.Algorithm)))
+			}
+			sort.Strings(described)
+			return "keys " + strings.Join(described, ", ")
+		}
+	}
+	return "other keys"
+}
+
+// zoneName formats the name of a zone for use in a sentence.
+func zoneName(zone string) string {
+	if zone == "." {
+		return "the root zone"
+	}
+	return strings.TrimSuffix(zone, ".")
+}
+
+// algorithmName formats a DNSSEC algorithm number with its mnemonic.
+func algorithmName(algorithm uint8) string {
+	if name, ok := dns.AlgorithmToString[algorithm]; ok {
+		return fmt.Sprintf("%v (%v)", algorithm, name)
+	}
+	return fmt.Sprintf("%v", algorithm)
+}
+
+// signatureTime returns the inception or the expiration of the RRSIG of
+// the rrset.
+func signatureTime(rrset *RRSet, inception bool) string {
+	if rrset == nil || !rrset.IsSigned() {
+		return "an unknown date"
+	}
+	t := rrset.RrSig.Expiration
+	if inception {
+		t = rrset.RrSig.Inception
+	}
+	return time.Unix(int64(t), 0).UTC().Format(time.RFC1123)
+}
+
+// contains returns true if s is one of the values.
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package resolver
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+	"time"
+)
+
+// GraphNodeKind is the kind of record a GraphNode stands for.
+type GraphNodeKind string
+
+const (
+	NodeDnskey GraphNodeKind = "DNSKEY"
+	NodeDs     GraphNodeKind = "DS"
+	NodeAnswer GraphNodeKind = "RRset"
+	// NodeMissing stands for a DNSKEY referenced by an RRSIG or DS record
+	// that is not part of the DNSKEY RRset of the Zone.
+	NodeMissing GraphNodeKind = "missing DNSKEY"
+)
+
+// EdgeStatus is the validation result of a GraphEdge.
+type EdgeStatus string
+
+const (
+	EdgeValid       EdgeStatus = "valid"
+	EdgeInvalid     EdgeStatus = "invalid"
+	EdgeExpired     EdgeStatus = "expired"
+	EdgeNotYetValid EdgeStatus = "not yet valid"
+	// EdgeUnverified is reported for edges left unchecked because the
+	// validation budget was exhausted.
+	EdgeUnverified EdgeStatus = "unverified"
+)
+
+// GraphNode is a DNSKEY, a DS record or the answer RRset of a Zone.
+type GraphNode struct {
+	ID    string        `json:"id"`
+	Zone  string        `json:"zone"`
+	Kind  GraphNodeKind `json:"kind"`
+	Label string        `json:"label"`
+}
+
+// GraphEdge is an RRSIG made by a DNSKEY over an RRset, or a DS record
+// pointing at the DNSKEY it is the digest of.
+type GraphEdge struct {
+	From   string     `json:"from"`
+	To     string     `json:"to"`
+	Label  string     `json:"label"`
+	Status EdgeStatus `json:"status"`
+}
+
+// ChainGraph is the AuthenticationChain as a graph of keys and records
+// connected by signatures and digests, ordered from the root Zone down.
+type ChainGraph struct {
+	Zones []string    `json:"zones"`
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// NodesOf returns the nodes of the graph that belong to zone.
+func (g *ChainGraph) NodesOf(zone string) []GraphNode {
+	nodes := make([]GraphNode, 0)
+	for _, n := range g.Nodes {
+		if n.Zone == zone {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// graphBuilder keeps track of the node identifiers while a ChainGraph is
+// built.
+type graphBuilder struct {
+	graph  *ChainGraph
+	keys   map[*dns.DNSKEY]string
+	budget *validationBudget
+}
+
+// Graph builds the ChainGraph of the chain of trust of answer.  Every
+// signature and digest is checked on its own, so unlike Verify the graph
+// shows all broken links rather than only the first one.  answer may be
+// nil, in which case only the chain is drawn.
+func (authChain *AuthenticationChain) Graph(answer *RRSet) *ChainGraph {
+	b := &graphBuilder{
+		graph: &ChainGraph{
+			Zones: make([]string, 0, len(authChain.DelegationChain)),
+			Nodes: make([]GraphNode, 0),
+			Edges: make([]GraphEdge, 0),
+		},
+		keys:   make(map[*dns.DNSKEY]string),
+		budget: newValidationBudget(authChain.Limits),
+	}
+
+	for i := len(authChain.DelegationChain) - 1; i >= 0; i-- {
+		signedZone := authChain.DelegationChain[i]
+		b.graph.Zones = append(b.graph.Zones, signedZone.Zone)
+		if signedZone.Dnskey == nil {
+			continue
+		}
+		for _, rr := range signedZone.Dnskey.RrSet {
+			if key, ok := rr.(*dns.DNSKEY); ok {
+				b.keys[key] = b.addNode(signedZone.Zone, NodeDnskey, keyLabel(key))
+			}
+		}
+	}
+
+	for i := len(authChain.DelegationChain) - 1; i >= 0; i-- {
+		signedZone := authChain.DelegationChain[i]
+		if signedZone.Dnskey != nil && signedZone.Dnskey.IsSigned() {
+			targets := make([]string, 0, len(signedZone.Dnskey.RrSet))
+			for _, rr := range signedZone.Dnskey.RrSet {
+				if key, ok := rr.(*dns.DNSKEY); ok {
+					targets = append(targets, b.keys[key])
+				}
+			}
+			b.addSignature(signedZone, signedZone.Dnskey, targets)
+		}
+		if signedZone.ParentZone != nil && signedZone.Ds != nil {
+			b.addDelegation(signedZone)
+		}
+	}
+
+	if answer != nil && !answer.IsEmpty() && len(authChain.DelegationChain) > 0 {
+		signedZone := authChain.DelegationChain[0]
+		rrtype := dns.TypeToString[answer.RrSet[0].Header().Rrtype]
+		id := b.addNode(signedZone.Zone, NodeAnswer, fmt.Sprintf("%v/%v", answer.RrSet[0].Header().Name, rrtype))
+		if answer.IsSigned() {
+			b.addSignature(signedZone, answer, []string{id})
+		}
+	}
+	return b.graph
+}
+
+// addNode adds a node to the graph and returns its identifier.
+func (b *graphBuilder) addNode(zone string, kind GraphNodeKind, label string) string {
+	id := fmt.Sprintf("n%d", len(b.graph.Nodes))
+	b.graph.Nodes = append(b.graph.Nodes, GraphNode{ID: id, Zone: zone, Kind: kind, Label: label})
+	return id
+}
+
+// signer returns the identifiers of the DNSKEYs of the Zone matching the
+// keytag and algorithm, or of a missing DNSKEY node if there is none.
+func (b *graphBuilder) signer(z SignedZone, keyTag uint16, algorithm uint8) ([]*dns.DNSKEY, []string) {
+	keys := z.lookupPubKey(keyTag, algorithm)
+	if len(keys) == 0 {
+		label := fmt.Sprintf("DNSKEY %v/%v", dns.AlgorithmToString[algorithm], keyTag)
+		for _, n := range b.graph.NodesOf(z.Zone) {
+			if n.Kind == NodeMissing && n.Label == label {
+				return nil, []string{n.ID}
+			}
+		}
+		return nil, []string{b.addNode(z.Zone, NodeMissing, label)}
+	}
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, b.keys[key])
+	}
+	return keys, ids
+}
+
+// addSignature adds the RRSIG edges from the DNSKEY of signer that made
+// the signature over rrset to each of the targets, the nodes of the
+// records in rrset.  The signature is verified once per candidate key.
+func (b *graphBuilder) addSignature(signer SignedZone, rrset *RRSet, targets []string) {
+	rrsig := rrset.RrSig
+	label := fmt.Sprintf("RRSIG %v", dns.TypeToString[rrsig.TypeCovered])
+	keys, ids := b.signer(signer, rrsig.KeyTag, rrsig.Algorithm)
+	statuses := make([]EdgeStatus, len(ids))
+	for i := range ids {
+		statuses[i] = EdgeInvalid
+	}
+	if keys != nil {
+		tooMany := b.budget.checkCandidates(len(keys)) != nil
+		for i, key := range keys {
+			statuses[i] = EdgeUnverified
+			if !tooMany && b.budget.spendVerification(i) == nil {
+				statuses[i] = signatureStatus(rrsig, key, rrset.RrSet, time.Now())
+			}
+		}
+	}
+	for i, id := range ids {
+		for _, to := range targets {
+			b.addEdge(id, to, label, statuses[i])
+		}
+	}
+}
+
+// addDelegation adds the DS nodes of the Zone, the RRSIG edges of the
+// parent over them and the digest edges from them to the DNSKEYs.
+func (b *graphBuilder) addDelegation(z SignedZone) {
+	dsIDs := make([]string, 0, len(z.Ds.RrSet))
+	for _, rr := range z.Ds.RrSet {
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			continue
+		}
+		id := b.addNode(z.Zone, NodeDs, fmt.Sprintf("DS %v/%v/%v", dns.AlgorithmToString[ds.Algorithm], ds.KeyTag, dns.HashToString[ds.DigestType]))
+		dsIDs = append(dsIDs, id)
+
+		keys, ids := b.signer(z, ds.KeyTag, ds.Algorithm)
+		if keys == nil {
+			b.addEdge(id, ids[0], "digest", EdgeInvalid)
+			continue
+		}
+		for i, key := range keys {
+			status := EdgeInvalid
+			if digest := key.ToDS(ds.DigestType); digest != nil && strings.EqualFold(digest.Digest, ds.Digest) {
+				status = EdgeValid
+			}
+			b.addEdge(id, ids[i], "digest", status)
+		}
+	}
+
+	if z.Ds.IsSigned() {
+		b.addSignature(*z.ParentZone, z.Ds, dsIDs)
+	}
+}
+
+// addEdge adds an edge to the graph.
+func (b *graphBuilder) addEdge(from string, to string, label string, status EdgeStatus) {
+	b.graph.Edges = append(b.graph.Edges, GraphEdge{From: from, To: to, Label: label, Status: status})
+}
+
+// signatureStatus verifies rrsig over rrset with key and checks its
+// validity period at t.
+func signatureStatus(rrsig *dns.RRSIG, key *dns.DNSKEY, rrset []dns.RR, t time.Time) EdgeStatus {
+	if rrsig.Verify(key, rrset) != nil {
+		return EdgeInvalid
+	}
+	if !rrsig.ValidityPeriod(t) {
+		if notYetValid(rrsig, t) {
+			return EdgeNotYetValid
+		}
+		return EdgeExpired
+	}
+	return EdgeValid
+}
+
+// keyLabel describes a DNSKEY by its role, algorithm and keytag.
+func keyLabel(key *dns.DNSKEY) string {
+	role := KeyRole(key)
+	if key.Flags&dns.REVOKE != 0 {
+		role = "revoked " + role
+	}
+	return fmt.Sprintf("DNSKEY %v %v/%v", role, dns.AlgorithmToString[key.Algorithm], key.KeyTag())
+}
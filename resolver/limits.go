@@ -0,0 +1,66 @@
+package resolver
+
+// Limits caps the amount of work performed while validating a single
+// answer, protecting the validator against adversarial zones such as
+// KeyTrap (CVE-2023-50387) and NSEC3 hash exhaustion (CVE-2023-50868).
+// Exceeding any of the caps fails the validation with
+// ErrValidationBudgetExceeded, except for MaxNSEC3Iterations: negative
+// answers denied by validated NSEC3 records above it are insecure, with
+// ErrNSEC3IterationsExceeded.
+type Limits struct {
+	// MaxVerificationsPerRRset caps the signature verifications
+	// attempted for a single RRset.
+	MaxVerificationsPerRRset int
+	// MaxVerifications caps the signature verifications attempted
+	// across the whole AuthenticationChain.
+	MaxVerifications int
+	// MaxKeyTagCandidates caps the number of DNSKEYs sharing a key tag
+	// and algorithm that are tried for a single RRSIG or DS.
+	MaxKeyTagCandidates int
+	// MaxNSEC3Iterations is the highest NSEC3 iteration count accepted
+	// in a response (RFC 9276).
+	MaxNSEC3Iterations uint16
+	// MaxChainDepth caps the number of zones in the delegation chain.
+	MaxChainDepth int
+}
+
+// DefaultLimits are the limits used by NewResolver.
+var DefaultLimits = Limits{
+	MaxVerificationsPerRRset: 8,
+	MaxVerifications:         32,
+	MaxKeyTagCandidates:      4,
+	MaxNSEC3Iterations:       150,
+	MaxChainDepth:            16,
+}
+
+// validationBudget tracks the work spent during one call to
+// AuthenticationChain.Verify against its Limits.
+type validationBudget struct {
+	limits        Limits
+	verifications int
+}
+
+func newValidationBudget(limits Limits) *validationBudget {
+	return &validationBudget{limits: limits}
+}
+
+// checkCandidates fails if too many keys share a key tag.
+func (b *validationBudget) checkCandidates(candidates int) error {
+	if candidates > b.limits.MaxKeyTagCandidates {
+		return ErrValidationBudgetExceeded
+	}
+	return nil
+}
+
+// spendVerification accounts for one signature verification, where
+// attempt is the number of verifications already made for the RRset.
+func (b *validationBudget) spendVerification(attempt int) error {
+	if attempt >= b.limits.MaxVerificationsPerRRset {
+		return ErrValidationBudgetExceeded
+	}
+	if b.verifications >= b.limits.MaxVerifications {
+		return ErrValidationBudgetExceeded
+	}
+	b.verifications++
+	return nil
+}
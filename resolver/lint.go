@@ -0,0 +1,365 @@
+package resolver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/miekg/dns"
+	"math/big"
+	"time"
+)
+
+// LintSeverity ranks the findings of the DNSSEC lint rules.
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+	LintInfo    LintSeverity = "info"
+)
+
+// Thresholds of the lint rules
+const (
+	LintMinRSAKeyBits       = 2048
+	LintMaxDnskeys          = 4
+	LintMaxDnskeyResponse   = 1232 // DNS Flag Day 2020 EDNS buffer size
+	LintMinSignatureRefresh = 3    // Remaining signature lifetime, in TTLs
+)
+
+// LintRule is a DNSSEC best practice check run against a Zone.
+type LintRule struct {
+	ID          string       `json:"id"`
+	Severity    LintSeverity `json:"severity"`
+	Explanation string       `json:"explanation"`
+	check       func(*lintContext) []string
+}
+
+// LintFinding is a violation of a LintRule.
+type LintFinding struct {
+	RuleID      string       `json:"rule"`
+	Severity    LintSeverity `json:"severity"`
+	Zone        string       `json:"zone"`
+	Message     string       `json:"message"`
+	Explanation string       `json:"explanation"`
+}
+
+// lintContext holds the data of the Zone the rules are checked against.
+type lintContext struct {
+	zone       *SignedZone
+	nsec3param *RRSet
+	now        time.Time
+}
+
+// LintRules is the rule set run by Lint.
+var LintRules = []LintRule{
+	{
+		ID:          "ALG-001",
+		Severity:    LintError,
+		Explanation: "RFC 8624 forbids signing with RSAMD5, DSA, DSA-NSEC3-SHA1 and ECC-GOST; validators no longer support them.",
+		check: func(ctx *lintContext) []string {
+			return keysWithAlgorithm(ctx, dns.RSAMD5, dns.DSA, dns.DSANSEC3SHA1, dns.ECCGOST)
+		},
+	},
+	{
+		ID:          "ALG-002",
+		Severity:    LintWarning,
+		Explanation: "RFC 8624 recommends against signing with RSASHA1, RSASHA1-NSEC3-SHA1 and RSASHA512; prefer ECDSAP256SHA256 or RSASHA256.",
+		check: func(ctx *lintContext) []string {
+			return keysWithAlgorithm(ctx, dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA512)
+		},
+	},
+	{
+		ID:          "KEY-001",
+		Severity:    LintWarning,
+		Explanation: fmt.Sprintf("RSA keys shorter than %v bits are considered too weak.", LintMinRSAKeyBits),
+		check: func(ctx *lintContext) []string {
+			messages := make([]string, 0)
+			for _, key := range ctx.zone.Keys() {
+				if bits := rsaKeyBits(key); bits > 0 && bits < LintMinRSAKeyBits {
+					messages = append(messages, fmt.Sprintf("DNSKEY %v (algorithm %v) is %v bits", key.KeyTag(), key.Algorithm, bits))
+				}
+			}
+			return messages
+		},
+	},
+	{
+		ID:          "KEY-002",
+		Severity:    LintWarning,
+		Explanation: fmt.Sprintf("More than %v DNSKEYs bloat the DNSKEY response and usually point to a stuck key rollover.", LintMaxDnskeys),
+		check: func(ctx *lintContext) []string {
+			if n := len(ctx.zone.Keys()); n > LintMaxDnskeys {
+				return []string{fmt.Sprintf("the zone publishes %v DNSKEYs", n)}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "KEY-003",
+		Severity:    LintError,
+		Explanation: "A signed zone must publish at least one DNSKEY and sign its DNSKEY RRset.",
+		check: func(ctx *lintContext) []string {
+			if len(ctx.zone.Keys()) == 0 {
+				return []string{"the zone publishes no DNSKEY"}
+			}
+			if !ctx.zone.Dnskey.IsSigned() {
+				return []string{"the DNSKEY RRset is not signed"}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "NSEC3-001",
+		Severity:    LintWarning,
+		Explanation: "RFC 9276 requires NSEC3 iterations to be 0; extra iterations cost validators and add no protection.",
+		check: func(ctx *lintContext) []string {
+			messages := make([]string, 0)
+			for _, rr := range ctx.nsec3param.RrSet {
+				if param, ok := rr.(*dns.NSEC3PARAM); ok && param.Iterations > 0 {
+					messages = append(messages, fmt.Sprintf("NSEC3PARAM uses %v iterations", param.Iterations))
+				}
+			}
+			return messages
+		},
+	},
+	{
+		ID:          "NSEC3-002",
+		Severity:    LintWarning,
+		Explanation: "RFC 9276 recommends an empty NSEC3 salt; a salt provides no protection against zone walking.",
+		check: func(ctx *lintContext) []string {
+			messages := make([]string, 0)
+			for _, rr := range ctx.nsec3param.RrSet {
+				if param, ok := rr.(*dns.NSEC3PARAM); ok && param.SaltLength > 0 {
+					messages = append(messages, fmt.Sprintf("NSEC3PARAM uses a %v byte salt", param.SaltLength))
+				}
+			}
+			return messages
+		},
+	},
+	{
+		ID:          "NSEC3-003",
+		Severity:    LintInfo,
+		Explanation: "RFC 9276 recommends NSEC3 opt-out only for very large and sparsely signed zones.",
+		check: func(ctx *lintContext) []string {
+			messages := make([]string, 0)
+			for _, rr := range ctx.nsec3param.RrSet {
+				if param, ok := rr.(*dns.NSEC3PARAM); ok && param.Flags&1 != 0 {
+					messages = append(messages, "NSEC3PARAM has the opt-out flag set")
+				}
+			}
+			return messages
+		},
+	},
+	{
+		ID:          "SIG-001",
+		Severity:    LintError,
+		Explanation: "Signatures outside of their validity period make the zone bogus.",
+		check: func(ctx *lintContext) []string {
+			messages := make([]string, 0)
+			for _, rrset := range ctx.signedRRsets() {
+				if !rrset.RrSig.ValidityPeriod(ctx.now) {
+					messages = append(messages, fmt.Sprintf("RRSIG %v by %v is not valid at %v", dns.TypeToString[rrset.RrSig.TypeCovered], rrset.RrSig.KeyTag, ctx.now.UTC().Format(time.RFC3339)))
+				}
+			}
+			return messages
+		},
+	},
+	{
+		ID:          "SIG-002",
+		Severity:    LintWarning,
+		Explanation: fmt.Sprintf("Signatures should be refreshed while at least %v TTLs of validity remain, so that cached copies never outlive them.", LintMinSignatureRefresh),
+		check: func(ctx *lintContext) []string {
+			messages := make([]string, 0)
+			for _, rrset := range ctx.signedRRsets() {
+				if !rrset.RrSig.ValidityPeriod(ctx.now) {
+					continue
+				}
+				remaining := signatureRemaining(rrset.RrSig, ctx.now)
+				if ttl := time.Duration(rrset.RrSig.OrigTtl) * time.Second; remaining < LintMinSignatureRefresh*ttl {
+					messages = append(messages, fmt.Sprintf("RRSIG %v expires in %v, TTL is %v", dns.TypeToString[rrset.RrSig.TypeCovered], remaining.Round(time.Second), ttl))
+				}
+			}
+			return messages
+		},
+	},
+	{
+		ID:          "DS-001",
+		Severity:    LintWarning,
+		Explanation: "RFC 8624 forbids creating DS records with SHA-1 digests; publish SHA-256 (digest type 2) instead.",
+		check: func(ctx *lintContext) []string {
+			return dsWithDigestType(ctx, dns.SHA1)
+		},
+	},
+	{
+		ID:          "DS-002",
+		Severity:    LintError,
+		Explanation: "DS records with GOST R 34.11-94 or unassigned digest types are ignored by validators.",
+		check: func(ctx *lintContext) []string {
+			messages := dsWithDigestType(ctx, dns.GOST94)
+			for _, rr := range ctx.zone.Ds.RrSet {
+				if ds, ok := rr.(*dns.DS); ok && !assignedDigestTypes[ds.DigestType] {
+					messages = append(messages, fmt.Sprintf("DS %v uses unassigned digest type %v", ds.KeyTag, ds.DigestType))
+				}
+			}
+			return messages
+		},
+	},
+	{
+		ID:          "SIZE-001",
+		Severity:    LintWarning,
+		Explanation: fmt.Sprintf("DNSKEY responses larger than %v bytes risk IP fragmentation or require a fallback to TCP.", LintMaxDnskeyResponse),
+		check: func(ctx *lintContext) []string {
+			msg := new(dns.Msg)
+			msg.SetQuestion(ctx.zone.Zone, dns.TypeDNSKEY)
+			msg.Answer = append(msg.Answer, ctx.zone.Dnskey.RrSet...)
+			if ctx.zone.Dnskey.IsSigned() {
+				msg.Answer = append(msg.Answer, ctx.zone.Dnskey.RrSig)
+			}
+			msg.SetEdns0(4096, true)
+			if size := msg.Len(); size > LintMaxDnskeyResponse {
+				return []string{fmt.Sprintf("the DNSKEY response is %v bytes", size)}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "TTL-001",
+		Severity:    LintWarning,
+		Explanation: "RRs of an RRset must share a TTL that does not exceed the original TTL of its RRSIG (RFC 2181, RFC 4035).",
+		check: func(ctx *lintContext) []string {
+			messages := make([]string, 0)
+			for _, rrset := range ctx.signedRRsets() {
+				for _, rr := range rrset.RrSet {
+					if rr.Header().Ttl > rrset.RrSig.OrigTtl {
+						messages = append(messages, fmt.Sprintf("%v TTL %v exceeds the RRSIG original TTL %v", dns.TypeToString[rr.Header().Rrtype], rr.Header().Ttl, rrset.RrSig.OrigTtl))
+						break
+					}
+					if rr.Header().Ttl != rrset.RrSet[0].Header().Ttl {
+						messages = append(messages, fmt.Sprintf("%v RRs have differing TTLs", dns.TypeToString[rr.Header().Rrtype]))
+						break
+					}
+				}
+			}
+			return messages
+		},
+	},
+}
+
+// assignedDigestTypes are the DS digest types assigned in the IANA
+// "Digest Algorithms" registry.
+var assignedDigestTypes = map[uint8]bool{
+	dns.SHA1:   true,
+	dns.SHA256: true,
+	dns.GOST94: true,
+	dns.SHA384: true,
+	5:          true, // GOST R 34.11-2012, RFC 9558
+	6:          true, // SM3, RFC 9563
+}
+
+// signedRRsets returns the signed RRsets of the Zone: its DNSKEY, DS and
+// NSEC3PARAM RRsets.
+func (ctx *lintContext) signedRRsets() []*RRSet {
+	rrsets := make([]*RRSet, 0, 3)
+	for _, rrset := range []*RRSet{ctx.zone.Dnskey, ctx.zone.Ds, ctx.nsec3param} {
+		if rrset != nil && rrset.IsSigned() && !rrset.IsEmpty() {
+			rrsets = append(rrsets, rrset)
+		}
+	}
+	return rrsets
+}
+
+// Lint populates the AuthenticationChain of zone and runs LintRules
+// against the zone and every signed zone above it, up to the root.  Each
+// finding names the zone it was found in.  The chain is returned along
+// with the findings.
+func (resolver *Resolver) Lint(zone string) ([]LintFinding, *AuthenticationChain, error) {
+	zone = dns.Fqdn(zone)
+	authChain := resolver.newAuthenticationChain()
+	if err := authChain.Populate(zone); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	findings := make([]LintFinding, 0)
+	for i := range authChain.DelegationChain {
+		signedZone := &authChain.DelegationChain[i]
+		// Labels above zone that are not zone apexes have no DNSKEY
+		if i > 0 && !signedZone.checkHasDnskeys() {
+			continue
+		}
+		nsec3param, err := queryRRset(signedZone.Zone, dns.TypeNSEC3PARAM)
+		if err != nil {
+			return nil, authChain, err
+		}
+		ctx := &lintContext{
+			zone:       signedZone,
+			nsec3param: nsec3param,
+			now:        now,
+		}
+		for _, rule := range LintRules {
+			for _, message := range rule.check(ctx) {
+				findings = append(findings, LintFinding{
+					RuleID:      rule.ID,
+					Severity:    rule.Severity,
+					Zone:        signedZone.Zone,
+					Message:     message,
+					Explanation: rule.Explanation,
+				})
+			}
+		}
+	}
+	return findings, authChain, nil
+}
+
+func keysWithAlgorithm(ctx *lintContext, algorithms ...uint8) []string {
+	messages := make([]string, 0)
+	for _, key := range ctx.zone.Keys() {
+		for _, algorithm := range algorithms {
+			if key.Algorithm == algorithm {
+				messages = append(messages, fmt.Sprintf("DNSKEY %v uses algorithm %v (%v)", key.KeyTag(), algorithm, dns.AlgorithmToString[algorithm]))
+			}
+		}
+	}
+	return messages
+}
+
+func dsWithDigestType(ctx *lintContext, digestType uint8) []string {
+	messages := make([]string, 0)
+	for _, rr := range ctx.zone.Ds.RrSet {
+		if ds, ok := rr.(*dns.DS); ok && ds.DigestType == digestType {
+			messages = append(messages, fmt.Sprintf("DS %v uses digest type %v (%v)", ds.KeyTag, digestType, dns.HashToString[digestType]))
+		}
+	}
+	return messages
+}
+
+// rsaKeyBits returns the modulus size of an RSA DNSKEY (RFC 3110), or 0
+// for keys of other algorithms.
+func rsaKeyBits(key *dns.DNSKEY) int {
+	switch key.Algorithm {
+	case dns.RSAMD5, dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+	default:
+		return 0
+	}
+	keybuf, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil || len(keybuf) < 1 {
+		return 0
+	}
+	explen, off := int(keybuf[0]), 1
+	if explen == 0 {
+		if len(keybuf) < 3 {
+			return 0
+		}
+		explen, off = int(keybuf[1])<<8|int(keybuf[2]), 3
+	}
+	if off+explen >= len(keybuf) {
+		return 0
+	}
+	return new(big.Int).SetBytes(keybuf[off+explen:]).BitLen()
+}
+
+// signatureRemaining returns the time left until the RRSIG expires.
+func signatureRemaining(rrsig *dns.RRSIG, t time.Time) time.Duration {
+	const year68 = 1 << 31
+	utc := t.UTC().Unix()
+	mode := (int64(rrsig.Expiration) - utc) / year68
+	return time.Duration(int64(rrsig.Expiration)+mode*year68-utc) * time.Second
+}
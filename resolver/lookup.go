@@ -1,6 +1,8 @@
 package resolver
 
 import (
+	"errors"
+	"fmt"
 	"github.com/miekg/dns"
 	"log"
 	"net"
@@ -43,7 +45,7 @@ func (resolver *Resolver) LookupIP(qname string) (ips []net.IP, err error) {
 	}
 
 	signerName := answers[0].SignerName()
-	authChain := NewAuthenticationChain()
+	authChain := resolver.newAuthenticationChain()
 	err = authChain.Populate(signerName)
 	if err != nil {
 		//log.Printf("Cannot populate authentication chain: %s\n", err)
@@ -92,7 +94,7 @@ func (resolver *Resolver) LookupIPType(qname string, qtype uint16) (ips []net.IP
 	}
 
 	signerName := answer.SignerName()
-	authChain := NewAuthenticationChain()
+	authChain := resolver.newAuthenticationChain()
 	err = authChain.Populate(signerName)
 	if err != nil {
 		//log.Printf("Cannot populate authentication chain: %s\n", err)
@@ -109,39 +111,129 @@ func (resolver *Resolver) LookupIPType(qname string, qtype uint16) (ips []net.IP
 }
 
 func (resolver *Resolver) StrictNSQuery(qname string, qtype uint16) (rrSet []dns.RR, chain *AuthenticationChain, err error) {
+	answer, authChain, err := resolver.QueryChain(qname, qtype)
+	if err != nil {
+		return nil, authChain, err
+	}
+	return answer.RrSet, authChain, nil
+}
+
+// lookupSecure fetches the qtype records of qname.  The records are only
+// returned if their DNSSEC status is Secure, any failure of the chain
+// validation is returned as error, and ErrNoResult if there are none.
+func (resolver *Resolver) lookupSecure(qname string, qtype uint16) ([]dns.RR, *AuthenticationChain, error) {
+	rrSet, chain, err := resolver.StrictNSQuery(qname, qtype)
+	if err != nil {
+		return nil, chain, err
+	}
+
+	records := make([]dns.RR, 0, len(rrSet))
+	for _, rr := range rrSet {
+		if rr.Header().Rrtype == qtype {
+			records = append(records, rr)
+		}
+	}
+	if len(records) == 0 {
+		return nil, chain, ErrNoResult
+	}
+	return records, chain, nil
+}
+
+// parameterName returns the mnemonic of a TLSA or SSHFP parameter value
+// in names, or the value itself if it has none.
+func parameterName(names map[uint8]string, value uint8) string {
+	if name, ok := names[value]; ok {
+		return name
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// QueryChain queries the qtype RRset of qname and validates it against
+// its AuthenticationChain.  Unlike StrictNSQuery, the signed answer is
+// returned along with the chain when the validation fails, so that
+// callers can show where the chain of trust breaks.
+func (resolver *Resolver) QueryChain(qname string, qtype uint16) (answer *RRSet, chain *AuthenticationChain, err error) {
+	answer, _, chain, err = resolver.QueryChainUpstream(qname, qtype)
+	return answer, chain, err
+}
+
+// QueryChainUpstream works like QueryChain and also returns the RCODE and
+// Extended DNS Errors of every upstream resolver that responded to the
+// query of the answer, whatever the outcome of the validation.
+func (resolver *Resolver) QueryChainUpstream(qname string, qtype uint16) (answer *RRSet, upstream []UpstreamResponse, chain *AuthenticationChain, err error) {
 	log.Printf("%v\n", qname)
 	if len(qname) < 1 {
-		return nil, nil, ErrInvalidQuery
+		return nil, nil, nil, ErrInvalidQuery
 	}
 
-	answer, err := queryRRset(qname, qtype)
+	answer, upstream, err = queryRRsetUpstream(qname, qtype)
+	if (err == ErrNameNotFound || err == nil && answer.IsEmpty()) && resolver.deniedByCostlyNSEC3(qname, answer) {
+		return nil, upstream, nil, ErrNSEC3IterationsExceeded
+	}
 	if err != nil {
-		return nil, nil, err
+		return nil, upstream, nil, err
 	}
 
 	if answer.IsEmpty() {
-		return nil, nil, ErrNoResult
+		return nil, upstream, nil, ErrNoResult
 	}
 
 	if !answer.IsSigned() {
-		return nil, nil, ErrResourceNotSigned
+		return nil, upstream, nil, ErrResourceNotSigned
 	}
 
-	signerName := answer.SignerName()
-
-	authChain := NewAuthenticationChain()
-	err = authChain.Populate(signerName)
-
-	if err == ErrNoResult {
-		return nil, nil, err
+	authChain, err := resolver.populateChain(answer.SignerName())
+	if authChain == nil {
+		return nil, upstream, nil, err
+	}
+	if err != nil {
+		return answer, upstream, authChain, err
 	}
 
 	err = authChain.Verify(answer)
 	if err != nil {
-		return nil, authChain, err
+		return answer, upstream, authChain, err
 	}
 
-	return answer.RrSet, authChain, nil
+	return answer, upstream, authChain, nil
+}
+
+// deniedByCostlyNSEC3 reports whether the negative answer to qname is
+// proven by NSEC3 records too expensive to hash (CVE-2023-50868), which
+// makes it insecure (RFC 9276, Section 3.2).  Only NSEC3 records signed
+// by a zone above qname and validating through its chain count, so that
+// forged or unsigned ones cannot downgrade the answer.
+func (resolver *Resolver) deniedByCostlyNSEC3(qname string, answer *RRSet) bool {
+	for _, nsec3 := range answer.denial {
+		if !nsec3.IsSigned() || !dns.IsSubDomain(nsec3.SignerName(), qname) {
+			continue
+		}
+		authChain, err := resolver.populateChain(nsec3.SignerName())
+		if authChain == nil || err != nil {
+			continue
+		}
+		if authChain.Verify(nsec3) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// populateChain builds the AuthenticationChain of signerName.  The chain
+// is nil if a Zone of it does not exist; it is returned along with the
+// error if the validation budget is exhausted.  Other errors leave the
+// chain incomplete, for Verify to report.
+func (resolver *Resolver) populateChain(signerName string) (*AuthenticationChain, error) {
+	authChain := resolver.newAuthenticationChain()
+	err := authChain.Populate(signerName)
+
+	if errors.Is(err, ErrNoResult) {
+		return nil, err
+	}
+	if err == ErrValidationBudgetExceeded {
+		return authChain, err
+	}
+	return authChain, nil
 }
 
 func FormatResultRRs(signedRrset *RRSet) []net.IP {
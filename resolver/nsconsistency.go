@@ -0,0 +1,317 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NameserverState is what a single authoritative server address answers
+// for the SOA and DNSKEY RRsets of a Zone.
+type NameserverState struct {
+	Nameserver string `json:"nameserver"`
+	Address    string `json:"address"`
+	// Lame is set if the server did not answer authoritatively.
+	Lame bool `json:"lame"`
+	// Skipped is set if the address was not queried because the host
+	// has no IPv6 connectivity.
+	Skipped   bool   `json:"skipped"`
+	SOASerial uint32 `json:"soaSerial"`
+	// DnskeySet is the sorted list of key tags of the DNSKEY RRset.
+	DnskeySet []uint16 `json:"dnskeySet"`
+	// DnskeySigned is set if an RRSIG over the DNSKEY RRset verifies
+	// against the DNSKEYs served and is within its validity period.
+	DnskeySigned bool   `json:"dnskeySigned"`
+	Err          error  `json:"-"`
+	dnskeyRdata  string `json:"-"`
+}
+
+// ZoneConsistency compares the answers of every authoritative server of
+// a Zone.
+type ZoneConsistency struct {
+	Zone            string            `json:"zone"`
+	Servers         []NameserverState `json:"servers"`
+	Inconsistencies []string          `json:"inconsistencies"`
+}
+
+// Consistent returns true if every server answered authoritatively with
+// the same SOA serial and DNSKEY RRset, validly signed.
+func (zc *ZoneConsistency) Consistent() bool {
+	return len(zc.Inconsistencies) == 0
+}
+
+// ErrIPv6Unavailable is set on the NameserverState of IPv6 addresses that
+// were skipped because the host has no IPv6 connectivity.
+var ErrIPv6Unavailable = errors.New("no IPv6 connectivity")
+
+// ipv6ProbeAddress is queried once to find out whether the host has IPv6
+// connectivity: the IPv6 address of a.root-servers.net.
+const ipv6ProbeAddress = "[2001:503:ba3e::2:30]:53"
+
+// consistencyCache holds the ZoneConsistency of every zone checked by
+// CheckChainNameservers, so that the name servers of the zones shared by
+// many names, such as the root and the TLDs, are queried once per run.
+type consistencyCache struct {
+	mu    sync.Mutex
+	zones map[string]*consistencyEntry
+}
+
+// consistencyEntry is the check of a zone, ready once done is closed.
+type consistencyEntry struct {
+	done   chan struct{}
+	result *ZoneConsistency
+}
+
+// CheckChainNameservers runs CheckNameservers on every Zone of the chain.
+// Labels of the chain that are not zone cuts, without DNSKEY at their
+// apex, are skipped as Lint does.  The result of each zone is cached for
+// the lifetime of the Resolver, and concurrent callers wait for a single
+// check of a zone.
+func (resolver *Resolver) CheckChainNameservers(authChain *AuthenticationChain) []*ZoneConsistency {
+	results := make([]*ZoneConsistency, 0, len(authChain.DelegationChain))
+	for i, signedZone := range authChain.DelegationChain {
+		if i > 0 && !signedZone.checkHasDnskeys() {
+			continue
+		}
+		results = append(results, resolver.cachedCheckNameservers(signedZone.Zone))
+	}
+	return results
+}
+
+// cachedCheckNameservers returns the cached check of zone, running
+// CheckNameservers the first time.
+func (resolver *Resolver) cachedCheckNameservers(zone string) *ZoneConsistency {
+	zone = dns.CanonicalName(zone)
+	cache := &resolver.nsConsistency
+	cache.mu.Lock()
+	if cache.zones == nil {
+		cache.zones = make(map[string]*consistencyEntry)
+	}
+	entry, ok := cache.zones[zone]
+	if !ok {
+		entry = &consistencyEntry{done: make(chan struct{})}
+		cache.zones[zone] = entry
+	}
+	cache.mu.Unlock()
+
+	if !ok {
+		entry.result = resolver.CheckNameservers(zone)
+		close(entry.done)
+	}
+	<-entry.done
+	return entry.result
+}
+
+// hasIPv6 returns true if the host can reach the IPv6 Internet, probed
+// once per Resolver.
+func (resolver *Resolver) hasIPv6() bool {
+	resolver.ipv6Probe.Do(func() {
+		dnsMessage := NewDNSMessage()
+		dnsMessage.RecursionDesired = false
+		dnsMessage.SetQuestion(".", dns.TypeSOA)
+		_, _, err := resolver.dnsClient.Exchange(dnsMessage, ipv6ProbeAddress)
+		resolver.ipv6Available = err == nil
+	})
+	return resolver.ipv6Available
+}
+
+// CheckNameservers queries every IPv4 and IPv6 address of every name
+// server of zone directly for its SOA and DNSKEY RRsets, and reports lame
+// servers and differences in SOA serials, DNSKEY RRsets and DNSKEY
+// signature validity between them.  IPv6 addresses are skipped if the
+// host has no IPv6 connectivity.
+func (resolver *Resolver) CheckNameservers(zone string) *ZoneConsistency {
+	zone = dns.Fqdn(zone)
+	result := &ZoneConsistency{
+		Zone:            zone,
+		Servers:         make([]NameserverState, 0),
+		Inconsistencies: make([]string, 0),
+	}
+
+	nameservers, err := queryRRset(zone, dns.TypeNS)
+	if err != nil || nameservers.IsEmpty() {
+		result.Inconsistencies = append(result.Inconsistencies, ErrNoNameservers.Error())
+		return result
+	}
+
+	for _, rr := range nameservers.RrSet {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		addresses := make([]string, 0)
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			rrset, err := queryRRset(ns.Ns, qtype)
+			if err != nil {
+				continue
+			}
+			for _, ip := range FormatResultRRs(rrset) {
+				addresses = append(addresses, ip.String())
+			}
+		}
+		if len(addresses) == 0 {
+			result.Servers = append(result.Servers, NameserverState{
+				Nameserver: ns.Ns,
+				Lame:       true,
+				Err:        ErrNoResult,
+			})
+			continue
+		}
+		for _, address := range addresses {
+			if net.ParseIP(address).To4() == nil && !resolver.hasIPv6() {
+				result.Servers = append(result.Servers, NameserverState{
+					Nameserver: ns.Ns,
+					Address:    address,
+					Skipped:    true,
+					DnskeySet:  make([]uint16, 0),
+					Err:        ErrIPv6Unavailable,
+				})
+				continue
+			}
+			result.Servers = append(result.Servers, resolver.queryNameserver(zone, ns.Ns, address))
+		}
+	}
+
+	result.compare()
+	return result
+}
+
+// compare fills the Inconsistencies of the ZoneConsistency from the
+// states of its servers.
+func (zc *ZoneConsistency) compare() {
+	serials := make(map[uint32][]string)
+	dnskeys := make(map[string][]string)
+	keyTags := make(map[string][]uint16)
+	for _, s := range zc.Servers {
+		server := s.Nameserver
+		if s.Address != "" {
+			server = fmt.Sprintf("%v(%v)", s.Nameserver, s.Address)
+		}
+		if s.Skipped {
+			continue
+		}
+		if s.Lame {
+			zc.Inconsistencies = append(zc.Inconsistencies, fmt.Sprintf("lame %v: %v", server, s.Err))
+			continue
+		}
+		if len(s.DnskeySet) > 0 && !s.DnskeySigned {
+			zc.Inconsistencies = append(zc.Inconsistencies, fmt.Sprintf("invalid DNSKEY RRSIG %v", server))
+		}
+		serials[s.SOASerial] = append(serials[s.SOASerial], server)
+		dnskeys[s.dnskeyRdata] = append(dnskeys[s.dnskeyRdata], server)
+		keyTags[s.dnskeyRdata] = s.DnskeySet
+	}
+	if len(serials) > 1 {
+		values := make([]string, 0, len(serials))
+		for serial, servers := range serials {
+			values = append(values, fmt.Sprintf("%v at %v", serial, strings.Join(servers, ",")))
+		}
+		sort.Strings(values)
+		zc.Inconsistencies = append(zc.Inconsistencies, fmt.Sprintf("SOA serials differ: %v", strings.Join(values, "; ")))
+	}
+	if len(dnskeys) > 1 {
+		values := make([]string, 0, len(dnskeys))
+		for rdata, servers := range dnskeys {
+			values = append(values, fmt.Sprintf("%v at %v", keyTags[rdata], strings.Join(servers, ",")))
+		}
+		sort.Strings(values)
+		zc.Inconsistencies = append(zc.Inconsistencies, fmt.Sprintf("DNSKEY RRsets differ: %v", strings.Join(values, "; ")))
+	}
+}
+
+// queryNameserver queries a single server address for the SOA and
+// DNSKEY RRsets of zone.
+func (resolver *Resolver) queryNameserver(zone string, nameserver string, address string) NameserverState {
+	state := NameserverState{
+		Nameserver: nameserver,
+		Address:    address,
+		DnskeySet:  make([]uint16, 0),
+	}
+
+	soa, err := resolver.queryAuthoritative(address, zone, dns.TypeSOA)
+	if err != nil {
+		state.Lame = true
+		state.Err = err
+		return state
+	}
+	for _, rr := range soa.Answer {
+		if t, ok := rr.(*dns.SOA); ok {
+			state.SOASerial = t.Serial
+		}
+	}
+
+	msg, err := resolver.queryAuthoritative(address, zone, dns.TypeDNSKEY)
+	if err != nil {
+		state.Lame = true
+		state.Err = err
+		return state
+	}
+	keys := make([]*dns.DNSKEY, 0)
+	keyRRs := make([]dns.RR, 0)
+	sigs := make([]*dns.RRSIG, 0)
+	for _, rr := range msg.Answer {
+		switch t := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, t)
+			keyRRs = append(keyRRs, t)
+		case *dns.RRSIG:
+			if t.TypeCovered == dns.TypeDNSKEY {
+				sigs = append(sigs, t)
+			}
+		}
+	}
+
+	rdata := make([]string, 0, len(keys))
+	for _, key := range keys {
+		state.DnskeySet = append(state.DnskeySet, key.KeyTag())
+		rdata = append(rdata, rdataString(key))
+	}
+	sort.Slice(state.DnskeySet, func(i, j int) bool { return state.DnskeySet[i] < state.DnskeySet[j] })
+	sort.Strings(rdata)
+	state.dnskeyRdata = strings.Join(rdata, "\n")
+
+	now := time.Now()
+	for _, sig := range sigs {
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if sig.Verify(key, keyRRs) == nil && sig.ValidityPeriod(now) {
+				state.DnskeySigned = true
+			}
+		}
+	}
+	return state
+}
+
+// queryAuthoritative sends a non recursive query to the server address,
+// retrying over TCP if the answer is truncated.  Answers that are not
+// authoritative or not NOERROR are returned as error.
+func (resolver *Resolver) queryAuthoritative(address string, qname string, qtype uint16) (*dns.Msg, error) {
+	dnsMessage := NewDNSMessage()
+	dnsMessage.RecursionDesired = false
+	dnsMessage.SetQuestion(qname, qtype)
+
+	server := net.JoinHostPort(address, strconv.Itoa(DNSPort))
+	r, _, err := resolver.exchange(resolver.dnsClient, dnsMessage, server)
+	if err == nil && r.Truncated {
+		tcpClient := &dns.Client{Net: "tcp", ReadTimeout: DefaultTimeout}
+		r, _, err = resolver.exchange(tcpClient, dnsMessage, server)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("answered %v", dns.RcodeToString[r.Rcode])
+	}
+	if !r.Authoritative {
+		return nil, fmt.Errorf("answer is not authoritative")
+	}
+	return r, nil
+}
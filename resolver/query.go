@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/miekg/dns"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -16,32 +17,47 @@ const (
 // the instantiated client and the func that performs the actual queries.
 // queryFn can be used for mocking the actual DNS lookups in the test suite.
 type Resolver struct {
-	queryFn   func(string, uint16) (*dns.Msg, error)
+	queryFn   func(string, uint16) (*dns.Msg, []UpstreamResponse, error)
 	dnsClient *dns.Client
+	Limits    Limits
+	// CheckingDisabled sets the CD bit on the queries sent upstream, so
+	// that validating resolvers hand out bogus data instead of SERVFAIL.
+	CheckingDisabled bool
+	// Tracer receives an event for every DNS exchange, see Subscribe.
+	Tracer *Tracer
+	// nsConsistency caches the name server checks of
+	// CheckChainNameservers.
+	nsConsistency consistencyCache
+	ipv6Probe     sync.Once
+	ipv6Available bool
 }
 
 // Errors returned by the verification/validation methods at all levels.
 var (
-	ErrResourceNotSigned    = errors.New("resource is not signed with RRSIG")
-	ErrNoResult             = errors.New("requested RR not found")
-	ErrNsNotAvailable       = errors.New("no name server to answer the question")
-	ErrDnskeyNotAvailable   = errors.New("DNSKEY RR does not exist")
-	ErrDsNotAvailable       = errors.New("DS RR does not exist")
-	ErrRRSigNotAvailable    = errors.New("RRSIG does not exist")
-	ErrInvalidRRsig         = errors.New("invalid RRSIG")
-	ErrRrsigValidationError = errors.New("RR doesn't validate against RRSIG")
-	ErrRrsigValidityPeriod  = errors.New("invalid RRSIG validity period")
-	ErrUnknownDsDigestType  = errors.New("unknown DS digest type")
-	ErrDsInvalid            = errors.New("DS RR does not match DNSKEY")
-	ErrInvalidQuery         = errors.New("invalid query input")
-	ErrDelegationChain      = errors.New("AuthChain has no Delegations")
+	ErrResourceNotSigned        = errors.New("resource is not signed with RRSIG")
+	ErrNoResult                 = errors.New("requested RR not found")
+	ErrNameNotFound             = fmt.Errorf("%w: no such domain", ErrNoResult)
+	ErrNsNotAvailable           = errors.New("no name server to answer the question")
+	ErrDnskeyNotAvailable       = errors.New("DNSKEY RR does not exist")
+	ErrDsNotAvailable           = errors.New("DS RR does not exist")
+	ErrRRSigNotAvailable        = errors.New("RRSIG does not exist")
+	ErrInvalidRRsig             = errors.New("invalid RRSIG")
+	ErrRrsigValidationError     = errors.New("RR doesn't validate against RRSIG")
+	ErrRrsigValidityPeriod      = errors.New("invalid RRSIG validity period")
+	ErrRrsigNotYetValid         = fmt.Errorf("%w: RRSIG is not yet valid", ErrRrsigValidityPeriod)
+	ErrUnknownDsDigestType      = errors.New("unknown DS digest type")
+	ErrDsInvalid                = errors.New("DS RR does not match DNSKEY")
+	ErrInvalidQuery             = errors.New("invalid query input")
+	ErrDelegationChain          = errors.New("AuthChain has no Delegations")
+	ErrValidationBudgetExceeded = errors.New("validation budget exceeded")
+	ErrNSEC3IterationsExceeded  = errors.New("NSEC3 iterations above limit")
 )
 
 var resolver *Resolver
 
 // NewDNSMessage creates and initializes a dns.Msg object, with EDNS enabled
 // and the DO (DNSSEC OK) flag set.  It returns a pointer to the created
-// object.
+// object.  The CD (Checking Disabled) flag is left to the caller.
 func NewDNSMessage() *dns.Msg {
 	dnsMessage := &dns.Msg{
 		MsgHdr: dns.MsgHdr{
@@ -55,24 +71,96 @@ func NewDNSMessage() *dns.Msg {
 // localQuery takes a query name (qname) and query type (qtype) and
 // performs a DNS lookup by calling dnsClient.Exchange.
 // It returns the answer in a *dns.Msg (or nil in case of an error, in which
-// case err will be set accordingly.)
-func localQuery(qname string, qtype uint16) (*dns.Msg, error) {
+// case err will be set accordingly.)  The RCODE and Extended DNS Errors of
+// every upstream that responded are returned along with it, those that
+// failed before one answered included.  An upstream that cannot be reached
+// is skipped; an UpstreamError is returned once all of them failed.
+func localQuery(qname string, qtype uint16) (*dns.Msg, []UpstreamResponse, error) {
 	dnsMessage := NewDNSMessage()
 	dnsMessage.SetQuestion(qname, qtype)
+	dnsMessage.CheckingDisabled = resolver.CheckingDisabled
 
 	servers := []string{CloudflareDNS, GoogleDNS, NextDNS}
+	responses := make([]UpstreamResponse, 0, len(servers))
+	failures := make([]error, 0, len(servers))
 
 	for _, server := range servers {
-		r, _, err := resolver.dnsClient.Exchange(dnsMessage, fmt.Sprintf("%s:%d", server, DNSPort))
+		r, _, err := resolver.exchange(resolver.dnsClient, dnsMessage, fmt.Sprintf("%s:%d", server, DNSPort))
 		if err != nil {
 			log.Printf("Using %v , error : %v", server, err)
-			return nil, err
+			failures = append(failures, fmt.Errorf("%v: %w", server, err))
+			continue
 		}
-		if r == nil || r.Rcode == dns.RcodeNameError || r.Rcode == dns.RcodeSuccess {
-			return r, err
+		responses = append(responses, newUpstreamResponse(server, r))
+		if r.Rcode == dns.RcodeNameError || r.Rcode == dns.RcodeSuccess {
+			return r, responses, nil
 		}
 	}
-	return nil, ErrNsNotAvailable
+	return nil, responses, &UpstreamError{Responses: responses, Failures: failures}
+}
+
+// UpstreamVerdict queries the upstream resolvers in order of preference
+// for qname with checking enabled (CD=0), regardless of CheckingDisabled,
+// and returns the first response received.  A validating upstream
+// answers SERVFAIL when it judges the data to be bogus; a SERVFAIL
+// without a DNSSEC Extended DNS Error is asked again with checking
+// disabled (CD=1) to tell bogus data from other failures.
+func (resolver *Resolver) UpstreamVerdict(qname string, qtype uint16) (*UpstreamResponse, error) {
+	servers := []string{CloudflareDNS, GoogleDNS, NextDNS}
+
+	var err error
+	for _, server := range servers {
+		var response *UpstreamResponse
+		response, err = resolver.queryUpstream(server, qname, qtype, false)
+		if err != nil {
+			log.Printf("Using %v , error : %v", server, err)
+			continue
+		}
+		if response.Rcode == dns.RcodeServerFailure && !response.dnssecFailure() {
+			unchecked, err := resolver.queryUpstream(server, qname, qtype, true)
+			if err != nil {
+				log.Printf("Using %v , error : %v", server, err)
+			} else {
+				response.AnswersWithCD = unchecked.Rcode == dns.RcodeSuccess || unchecked.Rcode == dns.RcodeNameError
+			}
+		}
+		return response, nil
+	}
+	return nil, err
+}
+
+// ProbeUpstreams queries every upstream resolver for qname with checking
+// enabled (CD=0) and returns their responses, including the AD bit, so
+// that they can be compared with the local validation result.  Upstreams
+// that cannot be reached are left out.
+func (resolver *Resolver) ProbeUpstreams(qname string, qtype uint16) []UpstreamResponse {
+	servers := []string{CloudflareDNS, GoogleDNS, NextDNS}
+
+	responses := make([]UpstreamResponse, 0, len(servers))
+	for _, server := range servers {
+		response, err := resolver.queryUpstream(server, qname, qtype, false)
+		if err != nil {
+			log.Printf("Using %v , error : %v", server, err)
+			continue
+		}
+		responses = append(responses, *response)
+	}
+	return responses
+}
+
+// queryUpstream sends qname to a single upstream server, with the CD bit
+// set to checkingDisabled, and summarises its response.
+func (resolver *Resolver) queryUpstream(server string, qname string, qtype uint16, checkingDisabled bool) (*UpstreamResponse, error) {
+	dnsMessage := NewDNSMessage()
+	dnsMessage.SetQuestion(qname, qtype)
+	dnsMessage.CheckingDisabled = checkingDisabled
+
+	r, _, err := resolver.exchange(resolver.dnsClient, dnsMessage, fmt.Sprintf("%s:%d", server, DNSPort))
+	if err != nil {
+		return nil, err
+	}
+	response := newUpstreamResponse(server, r)
+	return &response, nil
 }
 
 // queryDelegation takes a domain name and fetches the DS and DNSKEY records
@@ -85,7 +173,7 @@ func queryDelegation(domainName string) (signedZone *SignedZone, err error) {
 	if err != nil {
 		return nil, err
 	}
-	signedZone.PubKeyLookup = make(map[uint16]*dns.DNSKEY)
+	signedZone.PubKeyLookup = make(map[uint16][]*dns.DNSKEY)
 	for _, rr := range signedZone.Dnskey.RrSet {
 		defer func() {
 			if err := recover(); err != nil {
@@ -95,7 +183,13 @@ func queryDelegation(domainName string) (signedZone *SignedZone, err error) {
 		signedZone.addPubKey(rr.(*dns.DNSKEY))
 	}
 
-	signedZone.Ds, _ = queryRRset(domainName, dns.TypeDS)
+	signedZone.Ds, err = queryRRset(domainName, dns.TypeDS)
+	if err != nil && !errors.Is(err, ErrNoResult) {
+		return nil, err
+	}
+	if signedZone.Ds == nil {
+		signedZone.Ds = NewSignedRRSet()
+	}
 
 	return signedZone, nil
 }
@@ -111,5 +205,6 @@ func NewResolver() (res *Resolver, err error) {
 		return nil, err
 	}
 	resolver.queryFn = localQuery
+	resolver.Limits = DefaultLimits
 	return resolver, nil
 }
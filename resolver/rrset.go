@@ -5,29 +5,51 @@ import (
 	"log"
 )
 
+// RRSet holds the records of an RRset along with its signatures.  RrSig
+// is the first RRSIG received; RrSigs holds every one of them, as zones
+// in an algorithm or key rollover sign with several keys.
 type RRSet struct {
-	RrSet []dns.RR   `json:"RrSet"`
-	RrSig *dns.RRSIG `json:"RrSig"`
+	RrSet  []dns.RR     `json:"RrSet"`
+	RrSig  *dns.RRSIG   `json:"RrSig"`
+	RrSigs []*dns.RRSIG `json:"RrSigs,omitempty"`
+
+	// denial holds the NSEC3 RRsets of a negative answer whose iterations
+	// are above MaxNSEC3Iterations, with their signatures.
+	denial []*RRSet
 }
 
 func queryRRset(qname string, qtype uint16) (*RRSet, error) {
+	rrset, _, err := queryRRsetUpstream(qname, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return rrset, nil
+}
+
+// queryRRsetUpstream works like queryRRset and also returns the responses
+// of the upstream resolvers to the query, whatever its outcome.  The
+// empty RRset of an NXDOMAIN answer is returned along with
+// ErrNameNotFound, for its denial.
+func queryRRsetUpstream(qname string, qtype uint16) (*RRSet, []UpstreamResponse, error) {
 
-	r, err := resolver.queryFn(qname, qtype)
+	r, upstream, err := resolver.queryFn(qname, qtype)
 
 	if err != nil {
 		log.Printf("cannot lookup %v", err)
-		return nil, err
+		return nil, upstream, err
 	}
 
+	result := NewSignedRRSet()
+
 	if r.Rcode == dns.RcodeNameError {
 		log.Printf("no such domain %s\n", qname)
-		return nil, ErrNoResult
+		result.denial = costlyDenial(r.Ns, resolver.Limits.MaxNSEC3Iterations)
+		return result, upstream, ErrNameNotFound
 	}
 
-	result := NewSignedRRSet()
-
 	if r.Answer == nil {
-		return result, nil
+		result.denial = costlyDenial(r.Ns, resolver.Limits.MaxNSEC3Iterations)
+		return result, upstream, nil
 	}
 
 	result.RrSet = make([]dns.RR, 0, len(r.Answer))
@@ -35,14 +57,58 @@ func queryRRset(qname string, qtype uint16) (*RRSet, error) {
 	for _, rr := range r.Answer {
 		switch t := rr.(type) {
 		case *dns.RRSIG:
-			result.RrSig = t
+			result.addRRSIG(t)
 		default:
 			if rr != nil {
 				result.RrSet = append(result.RrSet, rr)
 			}
 		}
 	}
-	return result, nil
+	return result, upstream, nil
+}
+
+// costlyDenial returns the NSEC3 RRsets of the authority section ns whose
+// iterations are above limit, each with its RRSIGs.
+func costlyDenial(ns []dns.RR, limit uint16) []*RRSet {
+	owners := make(map[string]*RRSet)
+	denial := make([]*RRSet, 0)
+	for _, rr := range ns {
+		if nsec3, ok := rr.(*dns.NSEC3); ok && nsec3.Iterations > limit {
+			owner := dns.CanonicalName(nsec3.Hdr.Name)
+			if owners[owner] == nil {
+				owners[owner] = NewSignedRRSet()
+				denial = append(denial, owners[owner])
+			}
+			owners[owner].RrSet = append(owners[owner].RrSet, nsec3)
+		}
+	}
+	for _, rr := range ns {
+		if rrsig, ok := rr.(*dns.RRSIG); ok && rrsig.TypeCovered == dns.TypeNSEC3 {
+			if rrset := owners[dns.CanonicalName(rrsig.Hdr.Name)]; rrset != nil {
+				rrset.addRRSIG(rrsig)
+			}
+		}
+	}
+	return denial
+}
+
+// addRRSIG adds a signature of the RRset.
+func (sRRset *RRSet) addRRSIG(rrsig *dns.RRSIG) {
+	if sRRset.RrSig == nil {
+		sRRset.RrSig = rrsig
+	}
+	sRRset.RrSigs = append(sRRset.RrSigs, rrsig)
+}
+
+// signatures returns every RRSIG of the RRset, RrSig first.
+func (sRRset *RRSet) signatures() []*dns.RRSIG {
+	if len(sRRset.RrSigs) > 0 {
+		return sRRset.RrSigs
+	}
+	if sRRset.RrSig != nil {
+		return []*dns.RRSIG{sRRset.RrSig}
+	}
+	return nil
 }
 
 func (sRRset *RRSet) IsSigned() bool {
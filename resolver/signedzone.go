@@ -1,28 +1,52 @@
 package resolver
 
 import (
+	"errors"
 	"github.com/miekg/dns"
+	"sort"
 	"strings"
 	"time"
 )
 
 // SignedZone represents a DNSSEC-enabled Zone, its DNSKEY and DS records
 type SignedZone struct {
-	Zone         string                 `json:"zone"`
-	Dnskey       *RRSet                 `json:"dnskey"`
-	Ds           *RRSet                 `json:"ds"`
-	ParentZone   *SignedZone            `json:"parentZone"`
-	PubKeyLookup map[uint16]*dns.DNSKEY `json:"pkLookup"`
+	Zone         string                   `json:"zone"`
+	Dnskey       *RRSet                   `json:"dnskey"`
+	Ds           *RRSet                   `json:"ds"`
+	ParentZone   *SignedZone              `json:"parentZone"`
+	PubKeyLookup map[uint16][]*dns.DNSKEY `json:"pkLookup"`
 }
 
-// lookupPubkey returns a DNSKEY by its keytag
-func (z SignedZone) lookupPubKey(keyTag uint16) *dns.DNSKEY {
-	return z.PubKeyLookup[keyTag]
+// lookupPubKey returns every DNSKEY matching the keytag and algorithm.
+// Key tags are not unique, so callers must be prepared to try each
+// of the candidates in turn.
+func (z SignedZone) lookupPubKey(keyTag uint16, algorithm uint8) []*dns.DNSKEY {
+	candidates := make([]*dns.DNSKEY, 0, len(z.PubKeyLookup[keyTag]))
+	for _, k := range z.PubKeyLookup[keyTag] {
+		if k.Algorithm == algorithm {
+			candidates = append(candidates, k)
+		}
+	}
+	return candidates
 }
 
-// addPubkey stores a DNSKEY in the keytag lookup table.
+// addPubKey stores a DNSKEY in the keytag lookup table.
 func (z SignedZone) addPubKey(k *dns.DNSKEY) {
-	z.PubKeyLookup[k.KeyTag()] = k
+	keyTag := k.KeyTag()
+	z.PubKeyLookup[keyTag] = append(z.PubKeyLookup[keyTag], k)
+}
+
+// KeyTagCollisions returns the sorted list of key tags that are shared
+// by more than one DNSKEY in the Zone.
+func (z SignedZone) KeyTagCollisions() []uint16 {
+	collisions := make([]uint16, 0)
+	for keyTag, keys := range z.PubKeyLookup {
+		if len(keys) > 1 {
+			collisions = append(collisions, keyTag)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i] < collisions[j] })
+	return collisions
 }
 
 // verifyRRSIG verifies the signature on a signed
@@ -30,62 +54,173 @@ func (z SignedZone) addPubKey(k *dns.DNSKEY) {
 // It returns nil if the RRSIG verifies and the signature
 // is valid, and the appropriate error value in case
 // of validation failure.
-func (z SignedZone) verifyRRSIG(signedRRset *RRSet) (err error) {
+// Every signature verification is accounted against the budget.
+func (z SignedZone) verifyRRSIG(signedRRset *RRSet, budget *validationBudget) (err error) {
+	_, err = z.verifyRRSIGKey(signedRRset, budget)
+	return err
+}
+
+// verifyRRSIGKey is verifyRRSIG returning the DNSKEY the signature was
+// verified with, or the last candidate tried if none verified it.  The
+// RRset is valid if any of its RRSIGs is; if none is, the failure of
+// RrSig is returned.
+func (z SignedZone) verifyRRSIGKey(signedRRset *RRSet, budget *validationBudget) (key *dns.DNSKEY, err error) {
 
 	if !signedRRset.IsSigned() {
-		return ErrRRSigNotAvailable
+		return nil, ErrRRSigNotAvailable
+	}
+
+	attempt := 0
+	var firstKey *dns.DNSKEY
+	var firstErr error
+	for i, rrsig := range signedRRset.signatures() {
+		key, err := z.verifySignature(signedRRset.RrSet, rrsig, budget, &attempt)
+		if err == nil || errors.Is(err, ErrValidationBudgetExceeded) {
+			return key, err
+		}
+		if i == 0 {
+			firstKey, firstErr = key, err
+		}
 	}
+	return firstKey, firstErr
+}
 
-	// Verify the RRSIG of the DNSKEY RRset
-	key := z.lookupPubKey(signedRRset.RrSig.KeyTag)
-	if key == nil {
-		//log.Printf("DNSKEY keytag %d not found", signedRRset.RrSig.KeyTag)
-		return ErrDnskeyNotAvailable
+// verifySignature verifies a single RRSIG over rrs and checks its
+// validity period, trying every key that shares the keytag and
+// algorithm of the signature.  attempt counts the verifications made
+// for the RRset.
+func (z SignedZone) verifySignature(rrs []dns.RR, rrsig *dns.RRSIG, budget *validationBudget, attempt *int) (key *dns.DNSKEY, err error) {
+	keys := z.lookupPubKey(rrsig.KeyTag, rrsig.Algorithm)
+	if len(keys) == 0 {
+		//log.Printf("DNSKEY keytag %d not found", rrsig.KeyTag)
+		return nil, ErrDnskeyNotAvailable
+	}
+	if err := budget.checkCandidates(len(keys)); err != nil {
+		return nil, err
 	}
 
-	err = signedRRset.RrSig.Verify(key, signedRRset.RrSet)
+	for _, candidate := range keys {
+		if err := budget.spendVerification(*attempt); err != nil {
+			return key, err
+		}
+		*attempt++
+		key = candidate
+		err = rrsig.Verify(key, rrs)
+		if err == nil {
+			break
+		}
+	}
 	if err != nil {
 		//log.Println("DNSKEY verification", err)
-		return err
+		return key, err
 	}
 
-	if !signedRRset.RrSig.ValidityPeriod(time.Now()) {
+	now := time.Now()
+	if !rrsig.ValidityPeriod(now) {
 		//log.Println("invalid validity period", err)
-		return ErrRrsigValidityPeriod
+		if notYetValid(rrsig, now) {
+			return key, ErrRrsigNotYetValid
+		}
+		return key, ErrRrsigValidityPeriod
 	}
-	return nil
+	return key, nil
+}
+
+// notYetValid returns true if the inception of the RRSIG lies after t,
+// using the same serial number arithmetic as dns.RRSIG.ValidityPeriod.
+func notYetValid(rrsig *dns.RRSIG, t time.Time) bool {
+	const year68 = 1 << 31
+	utc := t.UTC().Unix()
+	modi := (int64(rrsig.Inception) - utc) / year68
+	return int64(rrsig.Inception)+modi*year68 > utc
+}
+
+// supportedDigestTypes are the DS digest types checked by verifyDS; RFC
+// 8624, Section 3.3 requires validators to support SHA-1 still.  DS
+// records of other types are ignored, as RFC 4035, Section 5.2 requires.
+var supportedDigestTypes = map[uint8]bool{
+	dns.SHA1:   true,
+	dns.SHA256: true,
+	dns.SHA384: true,
 }
 
 // verifyDS validates the DS record against the KSK
 // (key signing key) of the Zone.
 // Return nil if the DS record matches the digest of
 // the KSK.
-func (z SignedZone) verifyDS(dsRrset []dns.RR) (err error) {
+func (z SignedZone) verifyDS(dsRrset []dns.RR, budget *validationBudget) (err error) {
+	_, _, err = z.verifyDSKey(dsRrset, budget)
+	return err
+}
 
+// verifyDSKey is verifyDS returning the DS record checked and the DNSKEY
+// it matched, if any.  The delegation is valid if any DS record of a
+// supported digest type matches a DNSKEY; otherwise the first of them
+// that failed is returned along with the reason.
+func (z SignedZone) verifyDSKey(dsRrset []dns.RR, budget *validationBudget) (*dns.DS, *dns.DNSKEY, error) {
+
+	var failedDs *dns.DS
+	var failure error
 	for _, rr := range dsRrset {
 
 		ds := rr.(*dns.DS)
 
-		if ds.DigestType != dns.SHA256 {
+		if !supportedDigestTypes[ds.DigestType] {
 			//log.Printf("Unknown digest type (%d) on DS RR", ds.DigestType)
 			continue
 		}
 
 		parentDsDigest := strings.ToUpper(ds.Digest)
-		key := z.lookupPubKey(ds.KeyTag)
-		if key == nil {
+		keys := z.lookupPubKey(ds.KeyTag, ds.Algorithm)
+		if len(keys) == 0 {
 			//log.Printf("DNSKEY keytag %d not found", ds.KeyTag)
-			return ErrDnskeyNotAvailable
+			if failedDs == nil {
+				failedDs, failure = ds, ErrDnskeyNotAvailable
+			}
+			continue
 		}
-		dsDigest := strings.ToUpper(key.ToDS(ds.DigestType).Digest)
-		if parentDsDigest == dsDigest {
-			return nil
+		if err := budget.checkCandidates(len(keys)); err != nil {
+			return ds, nil, err
+		}
+		for _, key := range keys {
+			dsDigest := strings.ToUpper(key.ToDS(ds.DigestType).Digest)
+			if parentDsDigest == dsDigest {
+				return ds, key, nil
+			}
 		}
 
 		//log.Printf("DS does not match DNSKEY\n")
-		return ErrDsInvalid
+		if failedDs == nil {
+			failedDs, failure = ds, ErrDsInvalid
+		}
+	}
+	if failedDs != nil {
+		return failedDs, nil, failure
+	}
+	return nil, nil, ErrUnknownDsDigestType
+}
+
+// Keys returns the DNSKEYs published by the Zone.
+func (z SignedZone) Keys() []*dns.DNSKEY {
+	keys := make([]*dns.DNSKEY, 0)
+	if z.Dnskey == nil {
+		return keys
+	}
+	for _, rr := range z.Dnskey.RrSet {
+		if key, ok := rr.(*dns.DNSKEY); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// KeyRole returns "KSK" for a DNSKEY with the SEP flag set, "ZSK"
+// otherwise.
+func KeyRole(key *dns.DNSKEY) string {
+	if key.Flags&dns.SEP != 0 {
+		return "KSK"
 	}
-	return ErrUnknownDsDigestType
+	return "ZSK"
 }
 
 // checkHasDnskeys returns true if the SignedZone has a DNSKEY
@@ -0,0 +1,189 @@
+package resolver
+
+import (
+	"crypto"
+	"errors"
+	"github.com/miekg/dns"
+	"testing"
+	"time"
+)
+
+const testZone = "example.com."
+
+// testKey is a DNSKEY of testZone along with its private key.
+type testKey struct {
+	dnskey *dns.DNSKEY
+	signer crypto.Signer
+}
+
+func newTestKey(t *testing.T, flags uint16) testKey {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: testZone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	private, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+	return testKey{dnskey: key, signer: private.(crypto.Signer)}
+}
+
+// newCollidingKeys returns two distinct keys sharing a key tag, found by
+// generating keys until two tags collide.
+func newCollidingKeys(t *testing.T, flags uint16) (testKey, testKey) {
+	t.Helper()
+	seen := make(map[uint16]testKey)
+	for i := 0; i < 1<<14; i++ {
+		key := newTestKey(t, flags)
+		if other, ok := seen[key.dnskey.KeyTag()]; ok {
+			return other, key
+		}
+		seen[key.dnskey.KeyTag()] = key
+	}
+	t.Fatal("no key tag collision found")
+	return testKey{}, testKey{}
+}
+
+// sign returns the RRSIG of rrs made with the key, valid from inception
+// to expiration.
+func (k testKey) sign(t *testing.T, rrs []dns.RR, inception time.Time, expiration time.Time) *dns.RRSIG {
+	t.Helper()
+	rrsig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		KeyTag:     k.dnskey.KeyTag(),
+		SignerName: testZone,
+		Algorithm:  k.dnskey.Algorithm,
+		Inception:  uint32(inception.Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	if err := rrsig.Sign(k.signer, rrs); err != nil {
+		t.Fatalf("cannot sign: %v", err)
+	}
+	return rrsig
+}
+
+// newTestZone returns a SignedZone of testZone whose key tag lookup maps
+// keyTag to keys, in order.
+func newTestZone(keyTag uint16, keys ...*dns.DNSKEY) SignedZone {
+	zone := NewSignedZone(testZone)
+	zone.PubKeyLookup = map[uint16][]*dns.DNSKEY{keyTag: keys}
+	for _, key := range keys {
+		zone.Dnskey.RrSet = append(zone.Dnskey.RrSet, key)
+	}
+	return *zone
+}
+
+func testLimits(perRRset int, total int, candidates int) Limits {
+	limits := DefaultLimits
+	limits.MaxVerificationsPerRRset = perRRset
+	limits.MaxVerifications = total
+	limits.MaxKeyTagCandidates = candidates
+	return limits
+}
+
+func TestVerifyRRSIGKey(t *testing.T) {
+	decoy, zsk := newCollidingKeys(t, 256)
+	tag := zsk.dnskey.KeyTag()
+	a, err := dns.NewRR(testZone + " 3600 IN A 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rrs := []dns.RR{a}
+	now := time.Now()
+	valid := zsk.sign(t, rrs, now.Add(-time.Hour), now.Add(time.Hour))
+	expired := zsk.sign(t, rrs, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	forged := decoy.sign(t, rrs, now.Add(-time.Hour), now.Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		zone    SignedZone
+		rrsigs  []*dns.RRSIG
+		limits  Limits
+		wantKey *dns.DNSKEY
+		wantErr error
+	}{
+		{"single key", newTestZone(tag, zsk.dnskey), []*dns.RRSIG{valid}, DefaultLimits, zsk.dnskey, nil},
+		{"colliding key tags, second key verifies", newTestZone(tag, decoy.dnskey, zsk.dnskey), []*dns.RRSIG{valid}, DefaultLimits, zsk.dnskey, nil},
+		{"colliding key tags, no key verifies", newTestZone(tag, decoy.dnskey, decoy.dnskey), []*dns.RRSIG{valid}, DefaultLimits, decoy.dnskey, dns.ErrSig},
+		{"first signature forged, second verifies", newTestZone(tag, zsk.dnskey), []*dns.RRSIG{forged, valid}, DefaultLimits, zsk.dnskey, nil},
+		{"first signature expired, second verifies", newTestZone(tag, zsk.dnskey), []*dns.RRSIG{expired, valid}, DefaultLimits, zsk.dnskey, nil},
+		{"expired signature", newTestZone(tag, zsk.dnskey), []*dns.RRSIG{expired}, DefaultLimits, zsk.dnskey, ErrRrsigValidityPeriod},
+		{"unknown key tag", newTestZone(tag+1, zsk.dnskey), []*dns.RRSIG{valid}, DefaultLimits, nil, ErrDnskeyNotAvailable},
+		{"no signature", newTestZone(tag, zsk.dnskey), nil, DefaultLimits, nil, ErrRRSigNotAvailable},
+		{"RRset budget exhausted", newTestZone(tag, decoy.dnskey, zsk.dnskey), []*dns.RRSIG{valid}, testLimits(1, 32, 4), decoy.dnskey, ErrValidationBudgetExceeded},
+		{"chain budget exhausted", newTestZone(tag, decoy.dnskey, zsk.dnskey), []*dns.RRSIG{valid}, testLimits(8, 1, 4), decoy.dnskey, ErrValidationBudgetExceeded},
+		{"too many key tag candidates", newTestZone(tag, decoy.dnskey, zsk.dnskey), []*dns.RRSIG{valid}, testLimits(8, 32, 1), nil, ErrValidationBudgetExceeded},
+		{"signatures budget exhausted", newTestZone(tag, zsk.dnskey), []*dns.RRSIG{forged, valid}, testLimits(1, 32, 4), nil, ErrValidationBudgetExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrset := NewSignedRRSet()
+			rrset.RrSet = rrs
+			for _, rrsig := range tt.rrsigs {
+				rrset.addRRSIG(rrsig)
+			}
+			key, err := tt.zone.verifyRRSIGKey(rrset, newValidationBudget(tt.limits))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantKey != nil && key != tt.wantKey {
+				t.Errorf("key = %v, want %v", key, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestVerifyDSKey(t *testing.T) {
+	decoy, ksk := newCollidingKeys(t, 257)
+	tag := ksk.dnskey.KeyTag()
+
+	matching := ksk.dnskey.ToDS(dns.SHA256)
+	sha1 := ksk.dnskey.ToDS(dns.SHA1)
+	mismatching := decoy.dnskey.ToDS(dns.SHA256)
+	missing := ksk.dnskey.ToDS(dns.SHA256)
+	missing.KeyTag = tag + 1
+	unknown := ksk.dnskey.ToDS(dns.SHA256)
+	unknown.DigestType = dns.GOST94
+
+	tests := []struct {
+		name    string
+		zone    SignedZone
+		dsSet   []*dns.DS
+		limits  Limits
+		wantDs  *dns.DS
+		wantKey *dns.DNSKEY
+		wantErr error
+	}{
+		{"single DS", newTestZone(tag, ksk.dnskey), []*dns.DS{matching}, DefaultLimits, matching, ksk.dnskey, nil},
+		{"SHA-1 DS", newTestZone(tag, ksk.dnskey), []*dns.DS{sha1}, DefaultLimits, sha1, ksk.dnskey, nil},
+		{"first DS mismatches, second matches", newTestZone(tag, ksk.dnskey), []*dns.DS{mismatching, matching}, DefaultLimits, matching, ksk.dnskey, nil},
+		{"first DS without key, second matches", newTestZone(tag, ksk.dnskey), []*dns.DS{missing, matching}, DefaultLimits, matching, ksk.dnskey, nil},
+		{"colliding key tags, second key matches", newTestZone(tag, decoy.dnskey, ksk.dnskey), []*dns.DS{matching}, DefaultLimits, matching, ksk.dnskey, nil},
+		{"no DS matches", newTestZone(tag, ksk.dnskey), []*dns.DS{missing, mismatching}, DefaultLimits, missing, nil, ErrDnskeyNotAvailable},
+		{"DS mismatches", newTestZone(tag, ksk.dnskey), []*dns.DS{mismatching}, DefaultLimits, mismatching, nil, ErrDsInvalid},
+		{"unknown digest type only", newTestZone(tag, ksk.dnskey), []*dns.DS{unknown}, DefaultLimits, nil, nil, ErrUnknownDsDigestType},
+		{"unknown digest type skipped", newTestZone(tag, ksk.dnskey), []*dns.DS{unknown, matching}, DefaultLimits, matching, ksk.dnskey, nil},
+		{"too many key tag candidates", newTestZone(tag, decoy.dnskey, ksk.dnskey), []*dns.DS{matching}, testLimits(8, 32, 1), matching, nil, ErrValidationBudgetExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsRrset := make([]dns.RR, 0, len(tt.dsSet))
+			for _, ds := range tt.dsSet {
+				dsRrset = append(dsRrset, ds)
+			}
+			ds, key, err := tt.zone.verifyDSKey(dsRrset, newValidationBudget(tt.limits))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if ds != tt.wantDs {
+				t.Errorf("ds = %v, want %v", ds, tt.wantDs)
+			}
+			if key != tt.wantKey {
+				t.Errorf("key = %v, want %v", key, tt.wantKey)
+			}
+		})
+	}
+}
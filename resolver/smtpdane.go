@@ -0,0 +1,164 @@
+package resolver
+
+import (
+	"errors"
+	"github.com/miekg/dns"
+	"sort"
+)
+
+// DANEStatus is the SMTP DANE (RFC 7672) readiness of a mail domain or
+// of one of its MX hosts.
+type DANEStatus string
+
+const (
+	DANEProtected     DANEStatus = "dane-protected"
+	DANEMisconfigured DANEStatus = "dane-misconfigured"
+	DANEUnprotected   DANEStatus = "unprotected"
+	DANENoMailService DANEStatus = "no mail service"
+)
+
+// SMTPPort is the port whose TLSA records protect SMTP delivery.
+const SMTPPort = 25
+
+// ErrTLSAUnusable is returned when an MX host only publishes TLSA records
+// that SMTP clients must ignore (RFC 7672, Section 3.1.3).
+var ErrTLSAUnusable = errors.New("no usable TLSA record for SMTP")
+
+// MXDANEResult is the SMTP DANE readiness of a single MX host.
+type MXDANEResult struct {
+	Host       string      `json:"host"`
+	Preference uint16      `json:"preference"`
+	Secure     bool        `json:"secure"`
+	TLSA       []*dns.TLSA `json:"tlsa"`
+	Status     DANEStatus  `json:"status"`
+	Err        error       `json:"-"`
+}
+
+// SMTPDANEResult is the SMTP DANE readiness of a mail domain.  MXChain and
+// MXErr are the outcome of the DNSSEC validation of the MX RRset.
+type SMTPDANEResult struct {
+	Domain  string               `json:"domain"`
+	MXChain *AuthenticationChain `json:"-"`
+	MXErr   error                `json:"-"`
+	Status  DANEStatus           `json:"status"`
+	Hosts   []MXDANEResult       `json:"hosts"`
+}
+
+// CheckSMTPDANE resolves and validates the MX records of domain, then
+// checks the DNSSEC status and the _25._tcp TLSA records of every MX host
+// as described in RFC 7672.  Only the DNS side is checked, the TLSA records
+// are not matched against the certificates presented by the hosts.
+//
+// The domain is DANE protected if every MX host is, misconfigured if any
+// MX host publishes bogus or unusable TLSA records, and unprotected
+// otherwise.  A domain that does not exist or publishes a null MX
+// receives no mail at all.
+func (resolver *Resolver) CheckSMTPDANE(domain string) *SMTPDANEResult {
+	result := &SMTPDANEResult{
+		Domain: domain,
+		Status: DANEUnprotected,
+		Hosts:  make([]MXDANEResult, 0),
+	}
+
+	rrSet, chain, err := resolver.StrictNSQuery(domain, dns.TypeMX)
+	result.MXChain = chain
+	result.MXErr = err
+
+	mxs := make([]*dns.MX, 0, len(rrSet))
+	switch {
+	case errors.Is(err, ErrNameNotFound):
+		result.Status = DANENoMailService
+		return result
+	case errors.Is(err, ErrNoResult):
+		// Empty MX RRset, the domain itself is the implicit MX host
+		// (RFC 5321, Section 5.1)
+		mxs = append(mxs, &dns.MX{Mx: dns.Fqdn(domain)})
+	case err != nil:
+		if StatusOf(err) == StatusBogus {
+			result.Status = DANEMisconfigured
+		}
+		return result
+	}
+	for _, rr := range rrSet {
+		if mx, ok := rr.(*dns.MX); ok {
+			mxs = append(mxs, mx)
+		}
+	}
+	sort.Slice(mxs, func(i, j int) bool { return mxs[i].Preference < mxs[j].Preference })
+
+	// A null MX (RFC 7505) does not accept mail at all
+	if len(mxs) == 1 && mxs[0].Mx == "." {
+		result.Status = DANENoMailService
+		return result
+	}
+
+	protected := 0
+	for _, mx := range mxs {
+		host := resolver.checkMXHost(mx)
+		switch host.Status {
+		case DANEProtected:
+			protected++
+		case DANEMisconfigured:
+			result.Status = DANEMisconfigured
+		}
+		result.Hosts = append(result.Hosts, host)
+	}
+	if result.Status != DANEMisconfigured && protected > 0 && protected == len(mxs) {
+		result.Status = DANEProtected
+	}
+	return result
+}
+
+// checkMXHost checks the DNSSEC status of the address records of an MX
+// host and the usability of its _25._tcp TLSA records.
+func (resolver *Resolver) checkMXHost(mx *dns.MX) MXDANEResult {
+	host := MXDANEResult{
+		Host:       mx.Mx,
+		Preference: mx.Preference,
+		Status:     DANEUnprotected,
+	}
+
+	_, _, err := resolver.StrictNSQuery(mx.Mx, dns.TypeA)
+	if errors.Is(err, ErrNoResult) {
+		_, _, err = resolver.StrictNSQuery(mx.Mx, dns.TypeAAAA)
+	}
+	if err != nil {
+		host.Err = err
+		if StatusOf(err) == StatusBogus {
+			host.Status = DANEMisconfigured
+		}
+		return host
+	}
+	host.Secure = true
+
+	records, _, err := resolver.LookupTLSA(mx.Mx, SMTPPort, "tcp")
+	if err != nil {
+		host.Err = err
+		if StatusOf(err) == StatusBogus {
+			host.Status = DANEMisconfigured
+		}
+		return host
+	}
+	host.TLSA = records
+
+	for _, record := range records {
+		if usableSMTPTLSA(record) {
+			host.Status = DANEProtected
+			return host
+		}
+	}
+	host.Err = ErrTLSAUnusable
+	host.Status = DANEMisconfigured
+	return host
+}
+
+// usableSMTPTLSA returns true for the DANE-TA and DANE-EE records with
+// known selectors and matching types that SMTP clients act upon.
+func usableSMTPTLSA(record *dns.TLSA) bool {
+	if record.Usage != TLSAUsageDaneTA && record.Usage != TLSAUsageDaneEE {
+		return false
+	}
+	_, selector := tlsaSelectorNames[record.Selector]
+	_, matchingType := tlsaMatchingNames[record.MatchingType]
+	return selector && matchingType
+}
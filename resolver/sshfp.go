@@ -0,0 +1,239 @@
+package resolver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/miekg/dns"
+	"log"
+	"strings"
+)
+
+// SSHFP fingerprint types (RFC 4255, RFC 6594)
+const (
+	SSHFPTypeSHA1   = 1
+	SSHFPTypeSHA256 = 2
+)
+
+// ErrNoHostKeys is returned when no SSH host key could be parsed.
+var ErrNoHostKeys = errors.New("no SSH host key found")
+
+// sshKeyAlgorithms maps OpenSSH key types to SSHFP algorithm numbers
+// (RFC 4255, RFC 6594, RFC 7479, RFC 8709).
+var sshKeyAlgorithms = map[string]uint8{
+	"ssh-rsa":             1,
+	"ssh-dss":             2,
+	"ecdsa-sha2-nistp256": 3,
+	"ecdsa-sha2-nistp384": 3,
+	"ecdsa-sha2-nistp521": 3,
+	"ssh-ed25519":         4,
+	"ssh-ed448":           6,
+}
+
+var (
+	sshfpAlgorithmNames = map[uint8]string{1: "RSA", 2: "DSA", 3: "ECDSA", 4: "Ed25519", 6: "Ed448"}
+	sshfpTypeNames      = map[uint8]string{SSHFPTypeSHA1: "SHA-1", SSHFPTypeSHA256: "SHA-256"}
+)
+
+// SSHHostKey is an SSH public host key in OpenSSH format.
+type SSHHostKey struct {
+	Type    string `json:"type"`
+	Blob    []byte `json:"blob"`
+	Comment string `json:"comment"`
+}
+
+// Fingerprint returns the hex encoded SSHFP fingerprint of the key, or
+// false if the fingerprint type is unknown.
+func (k SSHHostKey) Fingerprint(fingerprintType uint8) (string, bool) {
+	switch fingerprintType {
+	case SSHFPTypeSHA1:
+		sum := sha1.Sum(k.Blob)
+		return hex.EncodeToString(sum[:]), true
+	case SSHFPTypeSHA256:
+		sum := sha256.Sum256(k.Blob)
+		return hex.EncodeToString(sum[:]), true
+	}
+	return "", false
+}
+
+// SSHFPResult is the outcome of comparing one SSHFP record against the
+// supplied host keys.
+type SSHFPResult struct {
+	Record          *dns.SSHFP `json:"record"`
+	Algorithm       string     `json:"algorithm"`
+	FingerprintType string     `json:"fingerprintType"`
+	// Status is "match", "mismatch" when keys of the algorithm were
+	// supplied but none matches, or "no key" if there were none.
+	Status string      `json:"status"`
+	Key    *SSHHostKey `json:"key,omitempty"`
+}
+
+// LookupSSHFP fetches the Secure SSHFP records of host, as lookupSecure
+// does.
+func (resolver *Resolver) LookupSSHFP(host string) ([]*dns.SSHFP, *AuthenticationChain, error) {
+	rrSet, chain, err := resolver.lookupSecure(dns.Fqdn(host), dns.TypeSSHFP)
+	if err != nil {
+		return nil, chain, err
+	}
+	records := make([]*dns.SSHFP, 0, len(rrSet))
+	for _, rr := range rrSet {
+		if sshfp, ok := rr.(*dns.SSHFP); ok {
+			records = append(records, sshfp)
+		}
+	}
+	return records, chain, nil
+}
+
+// MatchSSHFP compares every SSHFP record against the host keys of the
+// same algorithm.
+func MatchSSHFP(records []*dns.SSHFP, keys []SSHHostKey) []SSHFPResult {
+	results := make([]SSHFPResult, 0, len(records))
+	for _, record := range records {
+		result := SSHFPResult{
+			Record:          record,
+			Algorithm:       parameterName(sshfpAlgorithmNames, record.Algorithm),
+			FingerprintType: parameterName(sshfpTypeNames, record.Type),
+			Status:          "no key",
+		}
+		for i, key := range keys {
+			if sshKeyAlgorithms[key.Type] != record.Algorithm {
+				continue
+			}
+			result.Status = "mismatch"
+			fingerprint, ok := key.Fingerprint(record.Type)
+			if ok && strings.EqualFold(fingerprint, record.FingerPrint) {
+				result.Status = "match"
+				result.Key = &keys[i]
+				break
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ParseSSHHostKeys parses SSH public keys in OpenSSH public key file
+// format ("<type> <base64> [comment]") or known_hosts format.  Entries of
+// a known_hosts file are only kept if they list host, either in plain
+// or in hashed form; @revoked and @cert-authority entries are skipped.
+// Lines whose key cannot be decoded are skipped with a warning, as ssh
+// does.
+func ParseSSHHostKeys(data []byte, host string) ([]SSHHostKey, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	keys := make([]SSHHostKey, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			continue
+		}
+		if _, ok := sshKeyAlgorithms[fields[0]]; !ok {
+			// known_hosts entry, the key follows the host patterns
+			if !knownHostsMatch(fields[0], host) {
+				continue
+			}
+			fields = fields[1:]
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			log.Printf("skipping SSH key on line %d: %v", line, err)
+			continue
+		}
+		keys = append(keys, SSHHostKey{
+			Type:    fields[0],
+			Blob:    blob,
+			Comment: strings.Join(fields[2:], " "),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoHostKeys
+	}
+	return keys, nil
+}
+
+// knownHostsMatch returns true if the comma separated known_hosts
+// patterns list host, in plain form or hashed as |1|salt|hash.  As in
+// ssh, plain patterns may use the * and ? wildcards, and a matching
+// pattern negated with ! excludes host even if another pattern lists it.
+func knownHostsMatch(patterns string, host string) bool {
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		if strings.HasPrefix(pattern, "|1|") {
+			if hashedHostMatch(pattern, host) {
+				matched = true
+			}
+			continue
+		}
+		pattern = strings.ToLower(pattern)
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if !wildcardMatch(pattern, host) && !strings.HasPrefix(pattern, "["+host+"]:") {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// hashedHostMatch returns true if the |1|salt|hash known_hosts pattern is
+// the hash of host.
+func hashedHostMatch(pattern string, host string) bool {
+	parts := strings.Split(pattern[3:], "|")
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// wildcardMatch returns true if s matches pattern, where * matches any
+// run of characters and ? any single character.
+func wildcardMatch(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,42 @@
+package resolver
+
+import "errors"
+
+// SecurityStatus is the outcome of a validation as defined in
+// RFC 4033, Section 5.
+type SecurityStatus string
+
+const (
+	// StatusSecure means a chain of trust from the root to the answer
+	// validated.
+	StatusSecure SecurityStatus = "secure"
+	// StatusInsecure means the answer is provably not protected by DNSSEC,
+	// e.g. because it is unsigned or its zone has no DS at the parent.
+	StatusInsecure SecurityStatus = "insecure"
+	// StatusBogus means the answer should validate but a signature or
+	// delegation in the chain of trust is broken.
+	StatusBogus SecurityStatus = "bogus"
+	// StatusIndeterminate means no answer or chain of trust could be
+	// obtained, or the validation was aborted.
+	StatusIndeterminate SecurityStatus = "indeterminate"
+)
+
+// StatusOf classifies the error returned by StrictNSQuery or QueryChain.
+func StatusOf(err error) SecurityStatus {
+	switch {
+	case err == nil:
+		return StatusSecure
+	case errors.Is(err, ErrResourceNotSigned),
+		errors.Is(err, ErrDsNotAvailable),
+		errors.Is(err, ErrUnknownDsDigestType),     // RFC 4035, Section 5.2
+		errors.Is(err, ErrNSEC3IterationsExceeded): // RFC 9276, Section 3.2
+		return StatusInsecure
+	case errors.Is(err, ErrValidationBudgetExceeded):
+		return StatusIndeterminate
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return StatusBogus
+	}
+	return StatusIndeterminate
+}
@@ -0,0 +1,153 @@
+package resolver
+
+import (
+	"github.com/miekg/dns"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExchangeEvent describes a DNS message exchanged with a server.
+type ExchangeEvent struct {
+	Server           string
+	Qname            string
+	Qtype            uint16
+	RecursionDesired bool
+	CheckingDisabled bool
+	DnssecOK         bool
+	// Rcode, Flags and Size describe the response, if any was received.
+	Rcode int
+	Flags []string
+	Size  int
+	RTT   time.Duration
+	Err   error
+}
+
+// ValidationEvent describes a step of AuthenticationChain.Verify: the
+// DNSKEY that verified, or failed to verify, the RRSIG over an RRset, or
+// the DS record that matched a DNSKEY.
+type ValidationEvent struct {
+	Zone   string
+	Step   ValidationStep
+	RRType uint16
+	// Key is the DNSKEY used in the step, nil if none was found.
+	Key *dns.DNSKEY
+	// Ds is the DS record matched in the delegation step.
+	Ds  *dns.DS
+	Err error
+}
+
+// TraceEvent is passed to the TraceHooks subscribed to a Tracer.  Exactly
+// one of its fields is set.
+type TraceEvent struct {
+	Exchange   *ExchangeEvent
+	Validation *ValidationEvent
+}
+
+// TraceHook is called for every TraceEvent, in the order the steps are
+// made.
+type TraceHook func(TraceEvent)
+
+// Tracer dispatches the resolution and validation steps of a Resolver
+// and of its AuthenticationChains to the subscribed hooks.  A nil Tracer
+// drops every event.
+type Tracer struct {
+	mu    sync.Mutex
+	hooks []TraceHook
+}
+
+// Subscribe adds a hook called for every subsequent event.
+func (t *Tracer) Subscribe(hook TraceHook) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks = append(t.hooks, hook)
+}
+
+// emit calls the subscribed hooks with the event.
+func (t *Tracer) emit(event TraceEvent) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	hooks := t.hooks
+	t.mu.Unlock()
+	for _, hook := range hooks {
+		hook(event)
+	}
+}
+
+// Subscribe adds a hook called for every DNS exchange made by the
+// Resolver and every validation step of the chains it builds.
+func (resolver *Resolver) Subscribe(hook TraceHook) {
+	if resolver.Tracer == nil {
+		resolver.Tracer = &Tracer{}
+	}
+	resolver.Tracer.Subscribe(hook)
+}
+
+// exchange sends the message to the server with client and emits an
+// ExchangeEvent.
+func (resolver *Resolver) exchange(client *dns.Client, msg *dns.Msg, server string) (*dns.Msg, time.Duration, error) {
+	r, rtt, err := client.Exchange(msg, server)
+	if resolver.Tracer == nil {
+		return r, rtt, err
+	}
+
+	event := &ExchangeEvent{
+		Server:           server,
+		Qname:            msg.Question[0].Name,
+		Qtype:            msg.Question[0].Qtype,
+		RecursionDesired: msg.RecursionDesired,
+		CheckingDisabled: msg.CheckingDisabled,
+		RTT:              rtt,
+		Err:              err,
+	}
+	if opt := msg.IsEdns0(); opt != nil {
+		event.DnssecOK = opt.Do()
+	}
+	if r != nil {
+		event.Rcode = r.Rcode
+		event.Flags = headerFlags(r.MsgHdr)
+		event.Size = r.Len()
+	}
+	resolver.Tracer.emit(TraceEvent{Exchange: event})
+	return r, rtt, err
+}
+
+// headerFlags returns the flags set in a message header, in the order
+// used by dig.
+func headerFlags(h dns.MsgHdr) []string {
+	flags := make([]string, 0, 7)
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{h.Response, "qr"},
+		{h.Authoritative, "aa"},
+		{h.Truncated, "tc"},
+		{h.RecursionDesired, "rd"},
+		{h.RecursionAvailable, "ra"},
+		{h.AuthenticatedData, "ad"},
+		{h.CheckingDisabled, "cd"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
+// QueryFlags formats the flags of the query the way dig does, e.g. "+rd +do".
+func (e *ExchangeEvent) QueryFlags() string {
+	flags := make([]string, 0, 3)
+	if e.RecursionDesired {
+		flags = append(flags, "+rd")
+	}
+	if e.CheckingDisabled {
+		flags = append(flags, "+cd")
+	}
+	if e.DnssecOK {
+		flags = append(flags, "+do")
+	}
+	return strings.Join(flags, " ")
+}
@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// ValidationStep names the step of AuthenticationChain.Verify that failed.
+type ValidationStep string
+
+const (
+	StepAnswer     ValidationStep = "answer RRSIG"
+	StepDnskey     ValidationStep = "DNSKEY RRSIG"
+	StepDs         ValidationStep = "DS RRSIG"
+	StepDelegation ValidationStep = "DS digest"
+)
+
+// ValidationError describes where in the AuthenticationChain a validation
+// failed.  It wraps one of the package level sentinel errors (Err) so that
+// errors.Is keeps working, and keeps the underlying error (Cause), such as
+// the signature verification error returned by github.com/miekg/dns.
+type ValidationError struct {
+	Zone      string         `json:"zone"`
+	Step      ValidationStep `json:"step"`
+	RRType    uint16         `json:"rrType"`
+	KeyTag    uint16         `json:"keyTag"`
+	Algorithm uint8          `json:"algorithm"`
+	Err       error          `json:"-"`
+	Cause     error          `json:"-"`
+}
+
+// newValidationError builds a ValidationError for the step on zone,
+// taking the RR type, key tag and algorithm from the RRSIG of the
+// rrset, or from its first DS record for the delegation step, which the
+// caller replaces with the DS that failed when it knows it.
+func newValidationError(zone string, step ValidationStep, rrset *RRSet, err error, cause error) *ValidationError {
+	validationErr := &ValidationError{
+		Zone: zone,
+		Step: step,
+		Err:  err,
+	}
+	if cause != err {
+		validationErr.Cause = cause
+	}
+	if rrset == nil {
+		return validationErr
+	}
+	if step == StepDelegation && !rrset.IsEmpty() {
+		if ds, ok := rrset.RrSet[0].(*dns.DS); ok {
+			validationErr.RRType = dns.TypeDS
+			validationErr.KeyTag = ds.KeyTag
+			validationErr.Algorithm = ds.Algorithm
+		}
+		return validationErr
+	}
+	if rrset.IsSigned() {
+		validationErr.RRType = rrset.RrSig.TypeCovered
+		validationErr.KeyTag = rrset.RrSig.KeyTag
+		validationErr.Algorithm = rrset.RrSig.Algorithm
+	} else if !rrset.IsEmpty() {
+		validationErr.RRType = rrset.RrSet[0].Header().Rrtype
+	}
+	return validationErr
+}
+
+func (e *ValidationError) Error() string {
+	details := make([]string, 0, 3)
+	if e.RRType != 0 {
+		details = append(details, fmt.Sprintf("type %v", dns.TypeToString[e.RRType]))
+	}
+	if e.KeyTag != 0 || e.Algorithm != 0 {
+		details = append(details, fmt.Sprintf("keytag %v", e.KeyTag), fmt.Sprintf("algorithm %v", e.Algorithm))
+	}
+	msg := fmt.Sprintf("%v: %v", e.Zone, e.Step)
+	if len(details) > 0 {
+		msg = fmt.Sprintf("%v (%v)", msg, strings.Join(details, ", "))
+	}
+	msg = fmt.Sprintf("%v: %v", msg, e.Err)
+	if e.Cause != nil {
+		msg = fmt.Sprintf("%v: %v", msg, e.Cause)
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel error describing the failure.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target matches the underlying Cause, so that
+// for example an expired signature matches ErrRrsigValidityPeriod
+// even though the failure is reported as ErrRrsigValidationError.
+func (e *ValidationError) Is(target error) bool {
+	return e.Cause != nil && errors.Is(e.Cause, target)
+}
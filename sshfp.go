@@ -0,0 +1,68 @@
+package main
+
+import (
+	"DNSSEC-Validator/resolver"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"os"
+)
+
+// sshfpCheck fetches the DNSSEC validated SSHFP records of a host and
+// compares them against host keys in known_hosts or public key format.
+func sshfpCheck(c *cli.Context) error {
+	host := c.String("host")
+
+	paths := make([]string, 0, 2)
+	for _, path := range []string{c.String("known-hosts"), c.String("pubkey")} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return errors.New("either --known-hosts or --pubkey is required")
+	}
+	// The keys of both files are compared if both are given
+	keys := make([]resolver.SSHHostKey, 0)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fileKeys, err := resolver.ParseSSHHostKeys(data, host)
+		if err != nil && !errors.Is(err, resolver.ErrNoHostKeys) {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+		keys = append(keys, fileKeys...)
+	}
+	if len(keys) == 0 {
+		return resolver.ErrNoHostKeys
+	}
+
+	rq, err := resolver.NewResolver()
+	if err != nil {
+		return err
+	}
+	records, _, err := rq.LookupSSHFP(host)
+	if err != nil {
+		return fmt.Errorf("SSHFP lookup of %v failed: %w", host, err)
+	}
+
+	fmt.Printf("SSHFP records for %v (DNSSEC Secure)\n", host)
+	matched := 0
+	for _, result := range resolver.MatchSSHFP(records, keys) {
+		status := result.Status
+		if result.Key != nil {
+			matched++
+			status = fmt.Sprintf("%v (%v %v)", status, result.Key.Type, result.Key.Comment)
+		}
+		fmt.Printf("\t%v %v %v\n", result.Algorithm, result.FingerprintType, status)
+		fmt.Printf("\t\t%v\n", result.Record)
+	}
+
+	if matched == 0 {
+		return errors.New("no SSHFP record matches the host keys")
+	}
+	fmt.Printf("%v of %v SSHFP records match the host keys\n", matched, len(records))
+	return nil
+}
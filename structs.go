@@ -1,11 +1,61 @@
 package main
 
+import "DNSSEC-Validator/resolver"
+
 type Record struct {
-	Domain       string
-	DNSSECExists bool
-	DNSSECValid  bool
-	reason       string
-	ProtocolsUsed string
-	AlgorithmsUsed string
-	PublicKeySizes string
+	Domain                 string
+	QueryType              string
+	DNSSECExists           bool
+	DNSSECValid            bool
+	reason                 string
+	ProtocolsUsed          string
+	AlgorithmsUsed         string
+	PublicKeySizes         string
+	KeyTagCollisions       string
+	FailedZone             string
+	FailedStep             string
+	ExtendedError          string
+	UpstreamExtendedErrors string
+	UpstreamRcode          string
+	UpstreamBogus          string
+	UpstreamAD             string
+	ADDisagreement         string
+	DANEStatus             string
+	DANEDetails            string
+	CDSState               string
+	Bootstrap              string
+	BootstrapSignals       string
+	Misconfigurations      string
+	NSConsistency          string
+	// Line and Columns are the line number and the columns passed
+	// through of the input entry, seq its position among the entries
+	// measured.
+	Line    int
+	Columns []string
+	seq     int
+}
+
+// measurement holds the Records measured for an input Record.
+type measurement struct {
+	Input   Record
+	Results []Record
+}
+
+// MeasurementConfig holds the options of a measure run.
+type MeasurementConfig struct {
+	Workers int
+	// QueueSize bounds the number of input and result Records held in
+	// memory at once.
+	QueueSize        int
+	Profile          string
+	QueryTypes       []uint16
+	Limits           resolver.Limits
+	CheckingDisabled bool
+	UpstreamVerdict  bool
+	CompareAD        bool
+	CheckCDS         bool
+	CheckBootstrap   bool
+	Diagnose         bool
+	NSConsistency    bool
+	Ordered          bool
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"DNSSEC-Validator/resolver"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/urfave/cli/v2"
+	"strings"
+	"time"
+)
+
+// traceName validates the name given as argument and prints every DNS
+// exchange and validation step as it happens, followed by the result of
+// each type.  The exit code is the one of the query command.
+func traceName(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return cli.Exit("usage: trace <name>", ExitError)
+	}
+	qtypes, err := parseQueryTypes(c.StringSlice("type"))
+	if err != nil {
+		return cli.Exit(err, ExitError)
+	}
+
+	rq, err := resolver.NewResolver()
+	if err != nil {
+		return cli.Exit(err, ExitError)
+	}
+	rq.CheckingDisabled = c.Bool("checking-disabled")
+	rq.Subscribe(printTraceEvent)
+
+	errs := make([]error, 0, len(qtypes))
+	for _, qtype := range qtypes {
+		_, _, err := rq.QueryChain(dns.Fqdn(name), qtype)
+		status := string(resolver.StatusOf(err))
+		if err != nil {
+			status = fmt.Sprintf("%v: %v", status, err)
+		}
+		fmt.Printf("%v %v: %v\n\n", dns.Fqdn(name), dns.TypeToString[qtype], status)
+		errs = append(errs, err)
+	}
+	return exitStatus(errs)
+}
+
+// printTraceEvent prints a TraceEvent on a single line, in the style of
+// dig comments.
+func printTraceEvent(event resolver.TraceEvent) {
+	switch {
+	case event.Exchange != nil:
+		e := event.Exchange
+		fmt.Printf(";; %v %v %v %v -> ", e.Server, e.Qname, dns.TypeToString[e.Qtype], e.QueryFlags())
+		if e.Err != nil {
+			fmt.Printf("error: %v\n", e.Err)
+			return
+		}
+		fmt.Printf("%v [%v] %v, %d bytes\n", dns.RcodeToString[e.Rcode], strings.Join(e.Flags, " "), e.RTT.Round(time.Millisecond), e.Size)
+	case event.Validation != nil:
+		e := event.Validation
+		fmt.Printf(";; %v %v", e.Zone, e.Step)
+		if e.Ds != nil {
+			fmt.Printf(": DS %v/%v/%v", e.Ds.KeyTag, dns.AlgorithmToString[e.Ds.Algorithm], dns.HashToString[e.Ds.DigestType])
+		} else if e.RRType != 0 {
+			fmt.Printf(" over %v", dns.TypeToString[e.RRType])
+		}
+		if e.Key != nil {
+			verb := " with"
+			if e.Ds != nil {
+				verb = " matches"
+			}
+			fmt.Printf("%v DNSKEY %v %v/%v (%v)", verb, e.Key.Hdr.Name, e.Key.KeyTag(), dns.AlgorithmToString[e.Key.Algorithm], resolver.KeyRole(e.Key))
+		}
+		if e.Err != nil {
+			fmt.Printf(": %v\n", e.Err)
+			return
+		}
+		fmt.Printf(": ok\n")
+	}
+}